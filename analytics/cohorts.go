@@ -0,0 +1,139 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type CohortRequest struct {
+	// Months of the cohorts, From included and To excluded, every month when zero
+	From time.Time
+	To   time.Time
+	// Number of months of retention per cohort (12 by default)
+	Periods int
+	// Date until which retention is known (time.Now by default)
+	Now time.Time
+}
+
+// Cohort are the subscribers whose original purchase was made during a month
+type Cohort struct {
+	// First day of the month, in UTC
+	Month       time.Time
+	Subscribers int
+	// Subscribers still active N months after their original purchase, for the months already over
+	Retained []int
+	// Retained over Subscribers
+	Retention []float64
+}
+
+// CohortMatrix is the retention of monthly cohorts, in chronological order
+type CohortMatrix struct {
+	Periods int
+	Cohorts []Cohort
+}
+
+// Cohorts groups subscriptions by month of their original purchase and computes their retention:
+// a subscriber is retained N months later when one period of its renewal chain is active at that date.
+// The retention of a cohort after N months is only computed once the month N is over for all its subscribers.
+func Cohorts(source Source, request CohortRequest) (CohortMatrix, error) {
+	if !request.To.IsZero() && !request.To.After(request.From) {
+		return CohortMatrix{}, errors.New("invalid window")
+	}
+	if request.Periods < 0 {
+		return CohortMatrix{}, errors.New("number of periods is negative")
+	} else if request.Periods == 0 {
+		request.Periods = 12
+	}
+	if request.Now.IsZero() {
+		request.Now = time.Now()
+	}
+
+	purchases, err := collect(source)
+	if err != nil {
+		return CohortMatrix{}, err
+	}
+
+	cohorts := map[time.Time]*Cohort{}
+	for _, periods := range subscriptions(purchases) {
+		start := periods[0].PurchaseDate
+		if !inWindow(start, request.From, request.To) {
+			continue
+		}
+
+		month := monthOf(start)
+		cohort, found := cohorts[month]
+		if !found {
+			cohort = &Cohort{Month: month}
+			for n := 0; n < request.Periods && !month.AddDate(0, n+1, 0).After(request.Now); n++ {
+				cohort.Retained = append(cohort.Retained, 0)
+			}
+			cohorts[month] = cohort
+		}
+
+		cohort.Subscribers++
+		for n := range cohort.Retained {
+			at := start.AddDate(0, n, 0)
+			for _, period := range periods {
+				if period.IsActiveAt(at) {
+					cohort.Retained[n]++
+					break
+				}
+			}
+		}
+	}
+
+	matrix := CohortMatrix{Periods: request.Periods}
+	for _, cohort := range cohorts {
+		cohort.Retention = make([]float64, len(cohort.Retained))
+		for n, retained := range cohort.Retained {
+			cohort.Retention[n] = float64(retained) / float64(cohort.Subscribers)
+		}
+		matrix.Cohorts = append(matrix.Cohorts, *cohort)
+	}
+	sort.Slice(matrix.Cohorts, func(i, j int) bool {
+		return matrix.Cohorts[i].Month.Before(matrix.Cohorts[j].Month)
+	})
+
+	return matrix, nil
+}
+
+// WriteCSV writes one row per cohort: its month, its number of subscribers and its retention rates,
+// empty for the months not over yet.
+func (m CohortMatrix) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	header := []string{"cohort", "subscribers"}
+	for n := 0; n < m.Periods; n++ {
+		header = append(header, "month "+strconv.Itoa(n))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, cohort := range m.Cohorts {
+		row := []string{cohort.Month.Format("2006-01"), strconv.Itoa(cohort.Subscribers)}
+		for n := 0; n < m.Periods; n++ {
+			value := ""
+			if n < len(cohort.Retention) {
+				value = strconv.FormatFloat(cohort.Retention[n], 'f', 4, 64)
+			}
+			row = append(row, value)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// monthOf returns the first day of the month of t, in UTC
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
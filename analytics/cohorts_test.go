@@ -0,0 +1,64 @@
+package analytics_test
+
+import (
+	"bytes"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/analytics"
+	"reflect"
+	"testing"
+)
+
+func TestCohorts(t *testing.T) {
+	period := func(id, original, from, to string) iaphub.Purchase {
+		return iaphub.Purchase{Id: id, OriginalPurchase: original, IsSubscription: true, PurchaseDate: date(from), ExpirationDate: date(to)}
+	}
+	purchases := []iaphub.Purchase{
+		period("s1-3", "s1", "2019-11-10", "2019-12-10"),
+		period("s1-1", "s1", "2019-09-10", "2019-10-10"),
+		period("s1-2", "s1", "2019-10-10", "2019-11-10"),
+		period("s2-1", "s2", "2019-09-20", "2019-10-20"),
+		period("s3-1", "s3", "2019-10-05", "2020-10-05"),
+		period("s4-1", "s4", "2019-11-15", "2019-12-15"),
+		period("s5-1", "s5", "2019-12-05", "2020-01-05"),
+	}
+
+	matrix, err := analytics.Cohorts(analytics.FromPurchases(purchases), analytics.CohortRequest{Periods: 3, Now: date("2020-01-01")})
+	if err != nil {
+		t.Fatalf("Cohorts failed: %s", err)
+	}
+
+	expected := analytics.CohortMatrix{
+		Periods: 3,
+		Cohorts: []analytics.Cohort{
+			{Month: date("2019-09-01"), Subscribers: 2, Retained: []int{2, 1, 1}, Retention: []float64{1, 0.5, 0.5}},
+			{Month: date("2019-10-01"), Subscribers: 1, Retained: []int{1, 1, 1}, Retention: []float64{1, 1, 1}},
+			{Month: date("2019-11-01"), Subscribers: 1, Retained: []int{1, 0}, Retention: []float64{1, 0}},
+			{Month: date("2019-12-01"), Subscribers: 1, Retained: []int{1}, Retention: []float64{1}},
+		},
+	}
+	if !reflect.DeepEqual(matrix, expected) {
+		t.Errorf("wrong matrix; expected:\n%+v\ngot:\n%+v\n", expected, matrix)
+	}
+
+	var buf bytes.Buffer
+	if err := matrix.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %s", err)
+	}
+	expectedCSV := "cohort,subscribers,month 0,month 1,month 2\n" +
+		"2019-09,2,1.0000,0.5000,0.5000\n" +
+		"2019-10,1,1.0000,1.0000,1.0000\n" +
+		"2019-11,1,1.0000,0.0000,\n" +
+		"2019-12,1,1.0000,,\n"
+	if buf.String() != expectedCSV {
+		t.Errorf("wrong CSV; expected:\n%s\ngot:\n%s\n", expectedCSV, buf.String())
+	}
+
+	windowed, _ := analytics.Cohorts(analytics.FromPurchases(purchases), analytics.CohortRequest{
+		From: date("2019-10-01"),
+		To:   date("2019-11-01"),
+		Now:  date("2020-01-01"),
+	})
+	if len(windowed.Cohorts) != 1 || windowed.Periods != 12 || len(windowed.Cohorts[0].Retained) != 3 {
+		t.Errorf("wrong windowed matrix: %+v", windowed)
+	}
+}
@@ -0,0 +1,58 @@
+package analytics
+
+import (
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+)
+
+// Attribute of the purchases reports are sliced by
+type Dimension string
+
+const (
+	DimensionPlatform Dimension = "platform"
+	DimensionCountry  Dimension = "country"
+	DimensionSku      Dimension = "sku"
+	DimensionGroup    Dimension = "group"
+)
+
+// Value returns the value of the dimension for the purchase, the product group name for DimensionGroup.
+func (d Dimension) Value(purchase iaphub.Purchase) string {
+	switch d {
+	case DimensionPlatform:
+		return string(purchase.Platform)
+	case DimensionCountry:
+		return purchase.Country
+	case DimensionSku:
+		return purchase.ProductSku
+	case DimensionGroup:
+		return purchase.ProductGroupName
+	}
+
+	return ""
+}
+
+func validateDimensions(dimensions []Dimension) error {
+	for _, d := range dimensions {
+		switch d {
+		case DimensionPlatform, DimensionCountry, DimensionSku, DimensionGroup:
+		default:
+			return fmt.Errorf("unknown dimension %q", d)
+		}
+	}
+
+	return nil
+}
+
+// slice groups the purchases by value of each dimension
+func slice(purchases []iaphub.Purchase, dimensions []Dimension) map[Dimension]map[string][]iaphub.Purchase {
+	slices := map[Dimension]map[string][]iaphub.Purchase{}
+	for _, d := range dimensions {
+		slices[d] = map[string][]iaphub.Purchase{}
+		for _, purchase := range purchases {
+			value := d.Value(purchase)
+			slices[d][value] = append(slices[d][value], purchase)
+		}
+	}
+
+	return slices
+}
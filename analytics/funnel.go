@@ -0,0 +1,210 @@
+package analytics
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"sort"
+	"time"
+)
+
+type FunnelRequest struct {
+	// Window of the offer starts, From included and To excluded, every start when zero
+	From time.Time
+	To   time.Time
+	// Date deciding which offers are still running (time.Now by default)
+	Now time.Time
+}
+
+// FunnelStats sum up the conversion of an offer to the following price
+type FunnelStats struct {
+	// Subscriptions started with the offer
+	Starts int
+	// Subscriptions that reached the following price
+	Conversions int
+	// Subscriptions still in the offer, neither converted nor lost yet
+	Pending int
+	// Conversions over the starts that are not pending
+	ConversionRate float64
+	// Average time from the start of the offer to the first period at the following price
+	AverageTimeToConvert time.Duration
+}
+
+// FunnelRow are the stats of the offers of a product started during a week
+type FunnelRow struct {
+	Sku string
+	// Monday of the week, in UTC
+	Cohort time.Time
+	FunnelStats
+}
+
+type FunnelReport struct {
+	// Free trials, converted by the first paid period
+	Trial     FunnelStats
+	TrialRows []FunnelRow
+	// Periods flagged as trial conversion whose trial is not part of the source, by date of the conversion.
+	// They are left out of the trial stats and rows, their trial start being unknown.
+	TrialConversionsWithoutStart int
+	// Introductory prices, converted by the first period at the normal price
+	Intro     FunnelStats
+	IntroRows []FunnelRow
+}
+
+// offerStart is an offer started by a subscription and its outcome
+type offerStart struct {
+	sku       string
+	start     time.Time
+	converted bool
+	pending   bool
+	toConvert time.Duration
+	// Conversion whose offer period is not part of the source, start is the date of the conversion
+	withoutStart bool
+}
+
+// Funnel follows each subscription through its renewal chain, from its first trial or intro period
+// to its first period at the following price. Rows are sorted by cohort, then SKU.
+func Funnel(source Source, request FunnelRequest) (FunnelReport, error) {
+	if !request.To.IsZero() && !request.To.After(request.From) {
+		return FunnelReport{}, errors.New("invalid window")
+	}
+	if request.Now.IsZero() {
+		request.Now = time.Now()
+	}
+
+	purchases, err := collect(source)
+	if err != nil {
+		return FunnelReport{}, err
+	}
+
+	var report FunnelReport
+	var trials, intros []offerStart
+	for _, periods := range subscriptions(purchases) {
+		if start, ok := findOffer(periods, iaphub.SubscriptionPeriodTypeTrial, request.Now); ok && inWindow(start.start, request.From, request.To) {
+			if start.withoutStart {
+				report.TrialConversionsWithoutStart++
+			} else {
+				trials = append(trials, start)
+			}
+		}
+		if start, ok := findOffer(periods, iaphub.SubscriptionPeriodTypeIntro, request.Now); ok && inWindow(start.start, request.From, request.To) {
+			intros = append(intros, start)
+		}
+	}
+
+	report.Trial, report.TrialRows = funnelStats(trials)
+	report.Intro, report.IntroRows = funnelStats(intros)
+
+	return report, nil
+}
+
+// findOffer returns the first offer period of the subscription and its outcome.
+// Trials convert with any later paid period or period flagged as trial conversion, intro prices with a later
+// normal period. A trial conversion whose trial is not part of the source is returned without start.
+func findOffer(periods []iaphub.Purchase, offer iaphub.SubscriptionPeriodType, now time.Time) (offerStart, bool) {
+	trial := offer == iaphub.SubscriptionPeriodTypeTrial
+	for i, period := range periods {
+		if trial && period.IsTrialConversion && period.SubscriptionPeriodType != iaphub.SubscriptionPeriodTypeTrial {
+			return offerStart{sku: period.ProductSku, start: period.PurchaseDate, converted: true, withoutStart: true}, true
+		}
+		if period.SubscriptionPeriodType != offer {
+			continue
+		}
+
+		start := offerStart{sku: period.ProductSku, start: period.PurchaseDate}
+		last := period
+		for _, next := range periods[i+1:] {
+			converts := next.SubscriptionPeriodType == iaphub.SubscriptionPeriodTypeNormal ||
+				(trial && (next.IsTrialConversion || next.SubscriptionPeriodType != iaphub.SubscriptionPeriodTypeTrial))
+			if converts {
+				start.converted = true
+				start.toConvert = next.PurchaseDate.Sub(period.PurchaseDate)
+				return start, true
+			}
+			last = next
+		}
+		start.pending = last.IsActiveAt(now)
+
+		return start, true
+	}
+
+	return offerStart{}, false
+}
+
+func funnelStats(starts []offerStart) (FunnelStats, []FunnelRow) {
+	type rowKey struct {
+		sku    string
+		cohort time.Time
+	}
+	rows := map[rowKey][]offerStart{}
+	for _, start := range starts {
+		key := rowKey{start.sku, weekOf(start.start)}
+		rows[key] = append(rows[key], start)
+	}
+
+	var result []FunnelRow
+	for key, rowStarts := range rows {
+		result = append(result, FunnelRow{Sku: key.sku, Cohort: key.cohort, FunnelStats: sumStarts(rowStarts)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Cohort.Equal(result[j].Cohort) {
+			return result[i].Cohort.Before(result[j].Cohort)
+		}
+		return result[i].Sku < result[j].Sku
+	})
+
+	return sumStarts(starts), result
+}
+
+func sumStarts(starts []offerStart) FunnelStats {
+	var stats FunnelStats
+	var toConvert time.Duration
+	for _, start := range starts {
+		stats.Starts++
+		if start.converted {
+			stats.Conversions++
+			toConvert += start.toConvert
+		} else if start.pending {
+			stats.Pending++
+		}
+	}
+	if decided := stats.Starts - stats.Pending; decided > 0 {
+		stats.ConversionRate = float64(stats.Conversions) / float64(decided)
+	}
+	if stats.Conversions > 0 {
+		stats.AverageTimeToConvert = toConvert / time.Duration(stats.Conversions)
+	}
+
+	return stats
+}
+
+// subscriptions groups the subscription periods by original purchase, in chronological order
+func subscriptions(purchases []iaphub.Purchase) map[string][]iaphub.Purchase {
+	grouped := map[string][]iaphub.Purchase{}
+	for _, purchase := range purchases {
+		if purchase.IsSubscription {
+			key := subscriptionOf(purchase)
+			grouped[key] = append(grouped[key], purchase)
+		}
+	}
+	for key, periods := range grouped {
+		timeline := iaphub.NewTimeline(periods)
+		for i, period := range timeline.Periods {
+			periods[i] = period.Purchase
+		}
+		grouped[key] = periods
+	}
+
+	return grouped
+}
+
+// weekOf returns the Monday of the week of t, in UTC
+func weekOf(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := (int(day.Weekday()) + 6) % 7
+
+	return day.AddDate(0, 0, -offset)
+}
+
+func inWindow(t time.Time, from time.Time, to time.Time) bool {
+	return !t.Before(from) && (to.IsZero() || t.Before(to))
+}
@@ -0,0 +1,110 @@
+package analytics_test
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/analytics"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFunnel(t *testing.T) {
+	period := func(id, original, sku string, periodType iaphub.SubscriptionPeriodType, from, to string) iaphub.Purchase {
+		return iaphub.Purchase{
+			Id: id, OriginalPurchase: original, ProductSku: sku, IsSubscription: true,
+			SubscriptionPeriodType: periodType, PurchaseDate: date(from), ExpirationDate: date(to),
+		}
+	}
+	trial, intro, normal := iaphub.SubscriptionPeriodTypeTrial, iaphub.SubscriptionPeriodTypeIntro, iaphub.SubscriptionPeriodTypeNormal
+	purchases := []iaphub.Purchase{
+		period("s1-2", "s1", "monthly", normal, "2019-10-14", "2019-11-14"),
+		period("s1-1", "s1", "monthly", trial, "2019-10-07", "2019-10-14"),
+		period("s2-1", "s2", "monthly", trial, "2019-10-08", "2019-10-15"),
+		period("s3-1", "s3", "monthly", trial, "2019-10-30", "2019-11-06"),
+		period("s4-1", "s4", "yearly", trial, "2019-10-15", "2019-10-22"),
+		period("s4-2", "s4", "yearly", intro, "2019-10-22", "2019-11-22"),
+		period("s5-1", "s5", "monthly", intro, "2019-09-30", "2019-10-30"),
+		period("s5-2", "s5", "monthly", normal, "2019-10-30", "2019-11-30"),
+		{Id: "coins", ProductSku: "coins", PurchaseDate: date("2019-10-10")},
+	}
+
+	report, err := analytics.Funnel(analytics.FromPurchases(purchases), analytics.FunnelRequest{Now: date("2019-11-01")})
+	if err != nil {
+		t.Fatalf("Funnel failed: %s", err)
+	}
+
+	week := 7 * 24 * time.Hour
+	expected := analytics.FunnelReport{
+		Trial: analytics.FunnelStats{Starts: 4, Conversions: 2, Pending: 1, ConversionRate: 2.0 / 3, AverageTimeToConvert: week},
+		TrialRows: []analytics.FunnelRow{
+			{Sku: "monthly", Cohort: date("2019-10-07"), FunnelStats: analytics.FunnelStats{Starts: 2, Conversions: 1, ConversionRate: 0.5, AverageTimeToConvert: week}},
+			{Sku: "yearly", Cohort: date("2019-10-14"), FunnelStats: analytics.FunnelStats{Starts: 1, Conversions: 1, ConversionRate: 1, AverageTimeToConvert: week}},
+			{Sku: "monthly", Cohort: date("2019-10-28"), FunnelStats: analytics.FunnelStats{Starts: 1, Pending: 1}},
+		},
+		Intro: analytics.FunnelStats{Starts: 2, Conversions: 1, Pending: 1, ConversionRate: 1, AverageTimeToConvert: 30 * 24 * time.Hour},
+		IntroRows: []analytics.FunnelRow{
+			{Sku: "monthly", Cohort: date("2019-09-30"), FunnelStats: analytics.FunnelStats{Starts: 1, Conversions: 1, ConversionRate: 1, AverageTimeToConvert: 30 * 24 * time.Hour}},
+			{Sku: "yearly", Cohort: date("2019-10-21"), FunnelStats: analytics.FunnelStats{Starts: 1, Pending: 1}},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("wrong funnel; expected:\n%+v\ngot:\n%+v\n", expected, report)
+	}
+
+	windowed, _ := analytics.Funnel(analytics.FromPurchases(purchases), analytics.FunnelRequest{
+		From: date("2019-10-14"),
+		To:   date("2019-10-21"),
+		Now:  date("2019-11-01"),
+	})
+	if windowed.Trial.Starts != 1 || windowed.Intro.Starts != 0 {
+		t.Errorf("wrong windowed funnel: %+v", windowed)
+	}
+}
+
+func TestFunnel_TrialConversion(t *testing.T) {
+	purchases := []iaphub.Purchase{
+		// Trial outside of the source, only its conversion is known
+		{
+			Id: "s1-2", OriginalPurchase: "s1", ProductSku: "monthly", IsSubscription: true, IsTrialConversion: true,
+			SubscriptionPeriodType: iaphub.SubscriptionPeriodTypeNormal, PurchaseDate: date("2019-10-14"), ExpirationDate: date("2019-11-14"),
+		},
+		{
+			Id: "s1-3", OriginalPurchase: "s1", ProductSku: "monthly", IsSubscription: true,
+			SubscriptionPeriodType: iaphub.SubscriptionPeriodTypeNormal, PurchaseDate: date("2019-11-14"), ExpirationDate: date("2019-12-14"),
+		},
+		{
+			Id: "s2-1", OriginalPurchase: "s2", ProductSku: "monthly", IsSubscription: true,
+			SubscriptionPeriodType: iaphub.SubscriptionPeriodTypeTrial, PurchaseDate: date("2019-10-01"), ExpirationDate: date("2019-10-04"),
+		},
+		{
+			Id: "s2-2", OriginalPurchase: "s2", ProductSku: "monthly", IsSubscription: true, IsTrialConversion: true,
+			PurchaseDate: date("2019-10-04"), ExpirationDate: date("2019-11-04"),
+		},
+	}
+
+	report, err := analytics.Funnel(analytics.FromPurchases(purchases), analytics.FunnelRequest{Now: date("2019-12-01")})
+	if err != nil {
+		t.Fatalf("Funnel failed: %s", err)
+	}
+
+	// The conversion without trial is not a start of the cohort of its conversion week
+	expected := analytics.FunnelStats{Starts: 1, Conversions: 1, ConversionRate: 1, AverageTimeToConvert: 3 * 24 * time.Hour}
+	if !reflect.DeepEqual(report.Trial, expected) {
+		t.Errorf("wrong trial stats; expected: %+v, got: %+v", expected, report.Trial)
+	}
+	if len(report.TrialRows) != 1 || !report.TrialRows[0].Cohort.Equal(date("2019-09-30")) {
+		t.Errorf("wrong trial rows: %+v", report.TrialRows)
+	}
+	if report.TrialConversionsWithoutStart != 1 {
+		t.Errorf("wrong conversions without start; expected: 1, got: %d", report.TrialConversionsWithoutStart)
+	}
+
+	windowed, _ := analytics.Funnel(analytics.FromPurchases(purchases), analytics.FunnelRequest{
+		From: date("2019-10-14"),
+		To:   date("2019-10-21"),
+		Now:  date("2019-12-01"),
+	})
+	if windowed.Trial.Starts != 0 || len(windowed.TrialRows) != 0 || windowed.TrialConversionsWithoutStart != 1 {
+		t.Errorf("wrong windowed funnel: %+v", windowed)
+	}
+}
@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"sort"
+	"time"
+)
+
+// Range of days between a purchase and its refund
+type DaysBucket string
+
+const (
+	DaysSameDay DaysBucket = "0-1"
+	DaysWeek    DaysBucket = "2-7"
+	DaysMonth   DaysBucket = "8-30"
+	DaysQuarter DaysBucket = "31-90"
+	DaysLater   DaysBucket = "91+"
+	DaysUnknown DaysBucket = "unknown"
+)
+
+type RefundRequest struct {
+	// Window of the purchases, From included and To excluded. Their refunds count whenever they happened.
+	From time.Time
+	To   time.Time
+	// Dimensions to slice the report by, none by default
+	Dimensions []Dimension
+}
+
+type RefundStats struct {
+	Purchases int
+	Refunds   int
+	// Refunds over purchases
+	RefundRate float64
+	// Refunds with the chargeback or friendly_fraud reason
+	Chargebacks int
+	// Converted amount refunded
+	RefundedAmount float64
+	ByReason       map[iaphub.RefundReason]int
+	ByDays         map[DaysBucket]int
+}
+
+type RefundReport struct {
+	From  time.Time
+	To    time.Time
+	Total RefundStats
+	// Stats by dimension and value, e.g. Slices[DimensionSku]["coins_100"]
+	Slices map[Dimension]map[string]RefundStats
+}
+
+// RefundTrend is a slice whose refund rate rose between two reports
+type RefundTrend struct {
+	Dimension Dimension
+	Value     string
+	Previous  RefundStats
+	Current   RefundStats
+	// Increase of the refund rate
+	Increase float64
+}
+
+// Refunds breaks down the refunds of the purchases made in the window by reason, days since purchase and dimension.
+func Refunds(source Source, request RefundRequest) (RefundReport, error) {
+	if !request.To.After(request.From) {
+		return RefundReport{}, errors.New("invalid window")
+	}
+	if err := validateDimensions(request.Dimensions); err != nil {
+		return RefundReport{}, err
+	}
+
+	var purchases []iaphub.Purchase
+	err := source(func(purchase iaphub.Purchase) error {
+		if inWindow(purchase.PurchaseDate, request.From, request.To) {
+			purchases = append(purchases, purchase)
+		}
+		return nil
+	})
+	if err != nil {
+		return RefundReport{}, err
+	}
+
+	report := RefundReport{
+		From:  request.From,
+		To:    request.To,
+		Total: refundStats(purchases),
+	}
+	if len(request.Dimensions) > 0 {
+		report.Slices = map[Dimension]map[string]RefundStats{}
+		for d, values := range slice(purchases, request.Dimensions) {
+			report.Slices[d] = map[string]RefundStats{}
+			for value, sliced := range values {
+				report.Slices[d][value] = refundStats(sliced)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// RisingRefunds compares the slices of two reports, e.g. by SKU and country, and returns those whose refund rate
+// rose by at least minIncrease, with at least minPurchases purchases in the current report.
+// Trends are sorted by decreasing increase.
+func RisingRefunds(previous RefundReport, current RefundReport, minPurchases int, minIncrease float64) []RefundTrend {
+	var trends []RefundTrend
+	for d, values := range current.Slices {
+		for value, stats := range values {
+			if stats.Purchases < minPurchases {
+				continue
+			}
+			before := previous.Slices[d][value]
+			if increase := stats.RefundRate - before.RefundRate; increase >= minIncrease && increase > 0 {
+				trends = append(trends, RefundTrend{Dimension: d, Value: value, Previous: before, Current: stats, Increase: increase})
+			}
+		}
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Increase != trends[j].Increase {
+			return trends[i].Increase > trends[j].Increase
+		}
+		if trends[i].Dimension != trends[j].Dimension {
+			return trends[i].Dimension < trends[j].Dimension
+		}
+		return trends[i].Value < trends[j].Value
+	})
+
+	return trends
+}
+
+func refundStats(purchases []iaphub.Purchase) RefundStats {
+	stats := RefundStats{
+		ByReason: map[iaphub.RefundReason]int{},
+		ByDays:   map[DaysBucket]int{},
+	}
+	for _, purchase := range purchases {
+		stats.Purchases++
+		if !purchase.IsRefunded {
+			continue
+		}
+		stats.Refunds++
+		stats.RefundedAmount += purchase.ConvertedPrice - purchase.ConvertedNetPrice()
+		stats.ByReason[purchase.RefundReason]++
+		stats.ByDays[daysBucket(purchase)]++
+		if purchase.RefundReason == iaphub.RefundReasonChargeback || purchase.RefundReason == iaphub.RefundReasonFriendlyFraud {
+			stats.Chargebacks++
+		}
+	}
+	if stats.Purchases > 0 {
+		stats.RefundRate = float64(stats.Refunds) / float64(stats.Purchases)
+	}
+
+	return stats
+}
+
+func daysBucket(purchase iaphub.Purchase) DaysBucket {
+	if purchase.RefundDate.IsZero() || purchase.PurchaseDate.IsZero() {
+		return DaysUnknown
+	}
+
+	days := int(purchase.RefundDate.Sub(purchase.PurchaseDate).Hours() / 24)
+	switch {
+	case days <= 1:
+		return DaysSameDay
+	case days <= 7:
+		return DaysWeek
+	case days <= 30:
+		return DaysMonth
+	case days <= 90:
+		return DaysQuarter
+	}
+
+	return DaysLater
+}
@@ -0,0 +1,74 @@
+package analytics_test
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/analytics"
+	"reflect"
+	"testing"
+)
+
+func TestRefunds(t *testing.T) {
+	refunded := func(id, sku, country string, reason iaphub.RefundReason, purchased, refunded string) iaphub.Purchase {
+		p := iaphub.Purchase{Id: id, ProductSku: sku, Country: country, PurchaseDate: date(purchased), ConvertedPrice: 10}
+		if refunded != "" {
+			p.IsRefunded = true
+			p.RefundReason = reason
+			p.RefundDate = date(refunded)
+		}
+		return p
+	}
+	purchases := []iaphub.Purchase{
+		refunded("p1", "coins", "US", iaphub.RefundReasonChargeback, "2019-10-01", "2019-10-01"),
+		refunded("p2", "coins", "US", iaphub.RefundReasonFriendlyFraud, "2019-10-02", "2019-10-06"),
+		refunded("p3", "coins", "FR", "", "2019-10-03", ""),
+		refunded("p4", "monthly", "FR", iaphub.RefundReasonRemorse, "2019-10-04", "2019-11-20"),
+		refunded("p5", "monthly", "US", "", "2019-10-05", ""),
+		refunded("p6", "monthly", "US", iaphub.RefundReasonIssue, "2019-11-05", "2019-11-06"),
+	}
+	purchases[1].ConvertedRefundAmount = 4
+
+	report, err := analytics.Refunds(analytics.FromPurchases(purchases), analytics.RefundRequest{
+		From:       date("2019-10-01"),
+		To:         date("2019-11-01"),
+		Dimensions: []analytics.Dimension{analytics.DimensionSku, analytics.DimensionCountry},
+	})
+	if err != nil {
+		t.Fatalf("Refunds failed: %s", err)
+	}
+
+	expectedTotal := analytics.RefundStats{
+		Purchases:      5,
+		Refunds:        3,
+		RefundRate:     0.6,
+		Chargebacks:    2,
+		RefundedAmount: 24,
+		ByReason: map[iaphub.RefundReason]int{
+			iaphub.RefundReasonChargeback:    1,
+			iaphub.RefundReasonFriendlyFraud: 1,
+			iaphub.RefundReasonRemorse:       1,
+		},
+		ByDays: map[analytics.DaysBucket]int{analytics.DaysSameDay: 1, analytics.DaysWeek: 1, analytics.DaysQuarter: 1},
+	}
+	if !reflect.DeepEqual(report.Total, expectedTotal) {
+		t.Errorf("wrong total; expected:\n%+v\ngot:\n%+v\n", expectedTotal, report.Total)
+	}
+	if coins := report.Slices[analytics.DimensionSku]["coins"]; coins.Purchases != 3 || coins.Refunds != 2 {
+		t.Errorf("wrong coins stats: %+v", coins)
+	}
+
+	current, _ := analytics.Refunds(analytics.FromPurchases(purchases), analytics.RefundRequest{
+		From:       date("2019-11-01"),
+		To:         date("2019-12-01"),
+		Dimensions: []analytics.Dimension{analytics.DimensionSku, analytics.DimensionCountry},
+	})
+	trends := analytics.RisingRefunds(report, current, 1, 0.4)
+	if len(trends) != 1 || trends[0].Value != "monthly" || trends[0].Increase != 0.5 {
+		t.Errorf("wrong trends: %+v", trends)
+	}
+	if trends := analytics.RisingRefunds(report, current, 1, 0.1); len(trends) != 2 || trends[1].Value != "US" {
+		t.Errorf("wrong trends: %+v", trends)
+	}
+	if trends := analytics.RisingRefunds(report, current, 2, 0.1); len(trends) != 0 {
+		t.Errorf("expected no trend with too few purchases: %+v", trends)
+	}
+}
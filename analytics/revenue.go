@@ -0,0 +1,175 @@
+package analytics
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"math"
+	"time"
+)
+
+// Average number of days in a month, to normalize subscription prices
+const daysPerMonth = 365.25 / 12
+
+type RevenueRequest struct {
+	// Window of the revenue and churn, From included and To excluded. MRR is computed at To.
+	From time.Time
+	To   time.Time
+	// Dimensions to slice the report by, none by default
+	Dimensions []Dimension
+}
+
+// RevenueMetrics are computed from the converted prices, in the converted currency of IAPHUB
+type RevenueMetrics struct {
+	// Monthly recurring revenue of the subscriptions active at the end of the window
+	MRR float64
+	// Annual recurring revenue, 12 times the MRR
+	ARR float64
+	// Price of the purchases made in the window
+	GrossRevenue float64
+	// Gross revenue minus the refunded amounts
+	NetRevenue float64
+	Refunds    float64
+	Purchases  int
+	// Subscriptions active at the start of the window
+	StartSubscriptions int
+	// Subscriptions active at the end of the window
+	ActiveSubscriptions int
+	// Subscriptions active at the start of the window and no more at its end
+	ChurnedSubscriptions int
+	// ChurnedSubscriptions over StartSubscriptions
+	ChurnRate float64
+	// Users with at least one purchase
+	Customers int
+	// Average net revenue per customer, over every purchase of the source
+	LTV float64
+}
+
+type RevenueReport struct {
+	From     time.Time
+	To       time.Time
+	Currency string
+	Total    RevenueMetrics
+	// Metrics by dimension and value, e.g. Slices[DimensionCountry]["FR"]
+	Slices map[Dimension]map[string]RevenueMetrics
+}
+
+// Revenue computes revenue metrics over the purchases of the source.
+// Subscriptions are identified by their original purchase, and active when one of their periods is,
+// see Purchase.IsActiveAt. Their price is normalized to a month with the duration of the period.
+func Revenue(source Source, request RevenueRequest) (RevenueReport, error) {
+	if request.From.IsZero() || !request.To.After(request.From) {
+		return RevenueReport{}, errors.New("invalid window")
+	}
+	if err := validateDimensions(request.Dimensions); err != nil {
+		return RevenueReport{}, err
+	}
+
+	purchases, err := collect(source)
+	if err != nil {
+		return RevenueReport{}, err
+	}
+
+	report := RevenueReport{
+		From:  request.From,
+		To:    request.To,
+		Total: revenueMetrics(purchases, request.From, request.To),
+	}
+	for _, purchase := range purchases {
+		if purchase.ConvertedCurrency != "" {
+			report.Currency = purchase.ConvertedCurrency
+			break
+		}
+	}
+	if len(request.Dimensions) > 0 {
+		report.Slices = map[Dimension]map[string]RevenueMetrics{}
+		for d, values := range slice(purchases, request.Dimensions) {
+			report.Slices[d] = map[string]RevenueMetrics{}
+			for value, sliced := range values {
+				report.Slices[d][value] = revenueMetrics(sliced, request.From, request.To)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func revenueMetrics(purchases []iaphub.Purchase, from time.Time, to time.Time) RevenueMetrics {
+	var m RevenueMetrics
+	var lifetimeRevenue float64
+	customers := map[string]bool{}
+	startSubscriptions := map[string]bool{}
+	// Latest active period of each subscription, overlapping periods such as early renewals count once
+	activeSubscriptions := map[string]iaphub.Purchase{}
+
+	for _, purchase := range purchases {
+		lifetimeRevenue += purchase.ConvertedNetPrice()
+		if customer := purchase.CustomerId(); customer != "" {
+			customers[customer] = true
+		}
+
+		if !purchase.PurchaseDate.Before(from) && purchase.PurchaseDate.Before(to) {
+			m.Purchases++
+			m.GrossRevenue += purchase.ConvertedPrice
+			m.NetRevenue += purchase.ConvertedNetPrice()
+		}
+
+		if !purchase.IsSubscription {
+			continue
+		}
+		subscription := subscriptionOf(purchase)
+		if purchase.IsActiveAt(from) {
+			startSubscriptions[subscription] = true
+		}
+		// The window excludes To, the MRR is the one of its last instant
+		if purchase.IsActiveAt(to.Add(-time.Nanosecond)) {
+			if active, found := activeSubscriptions[subscription]; !found || purchase.PurchaseDate.After(active.PurchaseDate) {
+				activeSubscriptions[subscription] = purchase
+			}
+		}
+	}
+
+	for _, purchase := range activeSubscriptions {
+		m.MRR += monthlyPrice(purchase)
+	}
+	m.ARR = m.MRR * 12
+	m.Refunds = m.GrossRevenue - m.NetRevenue
+	m.StartSubscriptions = len(startSubscriptions)
+	m.ActiveSubscriptions = len(activeSubscriptions)
+	for subscription := range startSubscriptions {
+		if _, active := activeSubscriptions[subscription]; !active {
+			m.ChurnedSubscriptions++
+		}
+	}
+	if m.StartSubscriptions > 0 {
+		m.ChurnRate = float64(m.ChurnedSubscriptions) / float64(m.StartSubscriptions)
+	}
+	m.Customers = len(customers)
+	if m.Customers > 0 {
+		m.LTV = lifetimeRevenue / float64(m.Customers)
+	}
+
+	return m
+}
+
+// monthlyPrice normalizes the converted price of a subscription period to a month.
+// Periods of about a whole number of months count as such, e.g. 28 to 31 days as one month.
+func monthlyPrice(purchase iaphub.Purchase) float64 {
+	days := purchase.ExpirationDate.Sub(purchase.PurchaseDate).Hours() / 24
+	if days <= 0 {
+		return 0
+	}
+	months := days / daysPerMonth
+	if months >= 0.9 {
+		months = math.Round(months)
+	}
+
+	return purchase.ConvertedPrice / months
+}
+
+func subscriptionOf(purchase iaphub.Purchase) string {
+	if purchase.OriginalPurchase != "" {
+		return purchase.OriginalPurchase
+	}
+
+	return purchase.Id
+}
@@ -0,0 +1,146 @@
+package analytics_test
+
+import (
+	"bytes"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/analytics"
+	"github.com/n10ty/iaphub-go/export"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	t, _ := time.Parse("2006-01-02", value)
+	return t
+}
+
+// dummyHistory returns purchases around October 2019: two subscriptions active all month (monthly and yearly),
+// one churned, one refunded right after its purchase and a refunded consumable
+func dummyHistory() []iaphub.Purchase {
+	monthly := func(id, original, user, country, from, to string) iaphub.Purchase {
+		return iaphub.Purchase{
+			Id: id, OriginalPurchase: original, UserId: user, Country: country, Platform: iaphub.PlatformIOS,
+			ProductSku: "monthly", ProductGroupName: "premium", ProductType: iaphub.ProductTypeRenewableSubscription,
+			IsSubscription: true, PurchaseDate: date(from), ExpirationDate: date(to),
+			Price: 12, ConvertedPrice: 10, ConvertedCurrency: "USD",
+		}
+	}
+	refunded := monthly("e1", "e1", "u4", "US", "2019-10-20", "2019-11-20")
+	refunded.IsRefunded = true
+	refunded.RefundDate = date("2019-10-25")
+
+	return []iaphub.Purchase{
+		monthly("a1", "a1", "u1", "US", "2019-09-15", "2019-10-15"),
+		monthly("a2", "a1", "u1", "US", "2019-10-15", "2019-11-15"),
+		{
+			Id: "b1", OriginalPurchase: "b1", UserId: "u2", Country: "FR", Platform: iaphub.PlatformAndroid,
+			ProductSku: "yearly", ProductGroupName: "premium", ProductType: iaphub.ProductTypeRenewableSubscription,
+			IsSubscription: true, PurchaseDate: date("2019-09-20"), ExpirationDate: date("2020-09-20"),
+			ConvertedPrice: 120, ConvertedCurrency: "USD",
+		},
+		monthly("c1", "c1", "u3", "FR", "2019-09-10", "2019-10-10"),
+		{
+			Id: "d1", UserId: "u1", Country: "US", Platform: iaphub.PlatformIOS, ProductSku: "coins",
+			ProductType: iaphub.ProductTypeConsumable, PurchaseDate: date("2019-10-05"), ConvertedPrice: 5,
+			IsRefunded: true, RefundDate: date("2019-10-06"), ConvertedRefundAmount: 5,
+		},
+		refunded,
+	}
+}
+
+func TestRevenue(t *testing.T) {
+	report, err := analytics.Revenue(analytics.FromPurchases(dummyHistory()), analytics.RevenueRequest{
+		From:       date("2019-10-01"),
+		To:         date("2019-11-01"),
+		Dimensions: []analytics.Dimension{analytics.DimensionCountry, analytics.DimensionSku},
+	})
+	if err != nil {
+		t.Fatalf("Revenue failed: %s", err)
+	}
+
+	expectedTotal := analytics.RevenueMetrics{
+		MRR: 20, ARR: 240, GrossRevenue: 25, NetRevenue: 10, Refunds: 15, Purchases: 3,
+		StartSubscriptions: 3, ActiveSubscriptions: 2, ChurnedSubscriptions: 1, ChurnRate: 1.0 / 3,
+		Customers: 4, LTV: 37.5,
+	}
+	expectMetrics(t, "total", expectedTotal, report.Total)
+	expectMetrics(t, "US", analytics.RevenueMetrics{
+		MRR: 10, ARR: 120, GrossRevenue: 25, NetRevenue: 10, Refunds: 15, Purchases: 3,
+		StartSubscriptions: 1, ActiveSubscriptions: 1, Customers: 2, LTV: 10,
+	}, report.Slices[analytics.DimensionCountry]["US"])
+	expectMetrics(t, "FR", analytics.RevenueMetrics{
+		MRR: 10, ARR: 120, StartSubscriptions: 2, ActiveSubscriptions: 1, ChurnedSubscriptions: 1, ChurnRate: 0.5,
+		Customers: 2, LTV: 65,
+	}, report.Slices[analytics.DimensionCountry]["FR"])
+	if report.Currency != "USD" || len(report.Slices[analytics.DimensionSku]) != 3 {
+		t.Errorf("wrong report: %s, %v", report.Currency, report.Slices[analytics.DimensionSku])
+	}
+}
+
+func TestRevenue_OverlappingPeriods(t *testing.T) {
+	purchases := []iaphub.Purchase{
+		{
+			Id: "s1", User: "u1", IsSubscription: true, ConvertedPrice: 10,
+			PurchaseDate: date("2019-10-10"), ExpirationDate: date("2019-11-10"),
+		},
+		// Upgrade before the end of the first period
+		{
+			Id: "s1-2", OriginalPurchase: "s1", User: "u1", IsSubscription: true, ConvertedPrice: 20,
+			PurchaseDate: date("2019-10-20"), ExpirationDate: date("2019-11-20"),
+		},
+	}
+
+	report, err := analytics.Revenue(analytics.FromPurchases(purchases), analytics.RevenueRequest{
+		From: date("2019-10-01"),
+		To:   date("2019-11-01"),
+	})
+	if err != nil {
+		t.Fatalf("Revenue failed: %s", err)
+	}
+
+	expectMetrics(t, "total", analytics.RevenueMetrics{
+		MRR: 20, ARR: 240, GrossRevenue: 30, NetRevenue: 30, Purchases: 2, ActiveSubscriptions: 1, Customers: 1, LTV: 30,
+	}, report.Total)
+}
+
+func TestRevenue_FromJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _ := export.NewJSONLWriter(&buf)
+	for _, purchase := range dummyHistory() {
+		_ = writer.Write(purchase)
+	}
+
+	request := analytics.RevenueRequest{From: date("2019-10-01"), To: date("2019-11-01")}
+	fromFile, err := analytics.Revenue(analytics.FromJSONL(&buf), request)
+	if err != nil {
+		t.Fatalf("Revenue failed: %s", err)
+	}
+	inMemory, _ := analytics.Revenue(analytics.FromPurchases(dummyHistory()), request)
+	if !reflect.DeepEqual(fromFile, inMemory) {
+		t.Errorf("wrong report from export; expected:\n%#v\ngot:\n%#v\n", inMemory, fromFile)
+	}
+
+	if _, err := analytics.Revenue(analytics.FromPurchases(nil), analytics.RevenueRequest{From: request.To, To: request.From}); err == nil {
+		t.Errorf("expected error for invalid window")
+	}
+}
+
+func expectMetrics(t *testing.T, name string, expected analytics.RevenueMetrics, actual analytics.RevenueMetrics) {
+	t.Helper()
+	e, a := reflect.ValueOf(expected), reflect.ValueOf(actual)
+	for i := 0; i < e.NumField(); i++ {
+		field := e.Type().Field(i).Name
+		switch e.Field(i).Kind() {
+		case reflect.Float64:
+			if math.Abs(e.Field(i).Float()-a.Field(i).Float()) > 1e-9 {
+				t.Errorf("wrong %s %s; expected: %v, got: %v", name, field, e.Field(i).Float(), a.Field(i).Float())
+			}
+		default:
+			if e.Field(i).Interface() != a.Field(i).Interface() {
+				t.Errorf("wrong %s %s; expected: %v, got: %v", name, field, e.Field(i).Interface(), a.Field(i).Interface())
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/export"
+	"io"
+)
+
+// Source streams purchases to fn, stopping at the first error returned by fn
+type Source func(fn func(iaphub.Purchase) error) error
+
+// FromClient returns a Source reading the purchases matching the request from the API.
+func FromClient(client iaphub.PurchaseIterator, request iaphub.GetPurchasesRequest) Source {
+	return func(fn func(iaphub.Purchase) error) error {
+		return client.EachPurchase(request, fn)
+	}
+}
+
+// FromJSONL returns a Source reading purchases exported as JSON Lines, see export.JSONLWriter.
+func FromJSONL(r io.Reader) Source {
+	return func(fn func(iaphub.Purchase) error) error {
+		reader, err := export.NewJSONLReader(r)
+		if err != nil {
+			return err
+		}
+
+		return reader.Each(fn)
+	}
+}
+
+// FromPurchases returns a Source of purchases already in memory.
+func FromPurchases(purchases []iaphub.Purchase) Source {
+	return func(fn func(iaphub.Purchase) error) error {
+		for _, purchase := range purchases {
+			if err := fn(purchase); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// collect reads all the purchases of the source
+func collect(source Source) ([]iaphub.Purchase, error) {
+	var purchases []iaphub.Purchase
+	err := source(func(purchase iaphub.Purchase) error {
+		purchases = append(purchases, purchase)
+		return nil
+	})
+
+	return purchases, err
+}
@@ -0,0 +1,110 @@
+package iaphub
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/n10ty/iaphub-go/internal/fsutil"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the position of a Syncer in the purchase history
+type Checkpoint struct {
+	PurchaseDate time.Time `json:"purchaseDate"`
+	PurchaseId   string    `json:"purchaseId"`
+	// Fingerprints of the purchases seen inside the overlap window, by purchase id
+	Recent map[string]string `json:"recent,omitempty"`
+}
+
+func (cp Checkpoint) IsZero() bool {
+	return cp.PurchaseDate.IsZero() && cp.PurchaseId == ""
+}
+
+// CheckpointStore persists the Syncer checkpoint between runs.
+// Load returns a zero Checkpoint when nothing was saved yet.
+type CheckpointStore interface {
+	Load() (Checkpoint, error)
+	Save(checkpoint Checkpoint) error
+}
+
+type MemoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint Checkpoint
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{}
+}
+
+func (s *MemoryCheckpointStore) Load() (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return copyCheckpoint(s.checkpoint), nil
+}
+
+func (s *MemoryCheckpointStore) Save(checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = copyCheckpoint(checkpoint)
+
+	return nil
+}
+
+// FileCheckpointStore keeps the checkpoint in a JSON file.
+// The file is replaced atomically, so a crash during Save leaves the previous checkpoint intact.
+type FileCheckpointStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	if path == "" {
+		return nil, errors.New("checkpoint file path is not specified")
+	}
+
+	return &FileCheckpointStore{path: path}, nil
+}
+
+func (s *FileCheckpointStore) Load() (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var checkpoint Checkpoint
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, err
+	}
+	err = json.Unmarshal(data, &checkpoint)
+
+	return checkpoint, err
+}
+
+func (s *FileCheckpointStore) Save(checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.path, data)
+}
+
+func copyCheckpoint(checkpoint Checkpoint) Checkpoint {
+	if checkpoint.Recent == nil {
+		return checkpoint
+	}
+	recent := make(map[string]string, len(checkpoint.Recent))
+	for k, v := range checkpoint.Recent {
+		recent[k] = v
+	}
+	checkpoint.Recent = recent
+
+	return checkpoint
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"strings"
+	"time"
+)
+
+// tagsFlag collects repeated -tag key=value flags
+type tagsFlag map[string]string
+
+func (f tagsFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f tagsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("tag %q is not in key=value form", value)
+	}
+	f[parts[0]] = parts[1]
+
+	return nil
+}
+
+// timeFlag accepts RFC3339 dates or plain YYYY-MM-DD days
+type timeFlag struct {
+	time.Time
+}
+
+func (f *timeFlag) String() string {
+	return formatTime(f.Time)
+}
+
+func (f *timeFlag) Set(value string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			f.Time = t
+			return nil
+		}
+	}
+
+	return fmt.Errorf("date %q is neither RFC3339 nor YYYY-MM-DD", value)
+}
+
+// argument returns the single positional argument of a command
+func argument(args []string, name string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", usageError{fmt.Sprintf("expected a single %s argument", name)}
+	}
+
+	return args[0], nil
+}
+
+func runUserGet(a *app, args []string) error {
+	fs, common := newFlagSet("user get")
+	platform := fs.String("platform", "", "user platform: ios or android")
+	upsert := fs.Bool("upsert", false, "create the user if it does not exist")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	userId, err := argument(fs.Args(), "userId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	user, err := client.GetUser(iaphub.GetUserRequest{
+		UserId:   userId,
+		Platform: iaphub.Platform(*platform),
+		Upsert:   *upsert,
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.print(common.output, user, userTable(user))
+}
+
+func runUserMigrate(a *app, args []string) error {
+	fs, common := newFlagSet("user migrate")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	userId, err := argument(fs.Args(), "userId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	latestUser, err := client.GetUserMigrate(iaphub.GetUserMigrateRequest{UserId: userId})
+	if err != nil {
+		return err
+	}
+
+	return a.print(common.output, latestUser, fieldsTable(latestUser))
+}
+
+func runUserUpdate(a *app, args []string) error {
+	fs, common := newFlagSet("user update")
+	country := fs.String("country", "", "user country")
+	upsert := fs.Bool("upsert", false, "create the user if it does not exist")
+	tags := tagsFlag{}
+	fs.Var(tags, "tag", "user tag as key=value, can be repeated")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	userId, err := argument(fs.Args(), "userId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	err = client.UpdateUser(iaphub.UpdateUserRequest{
+		UserId:  userId,
+		Country: *country,
+		Upsert:  *upsert,
+		Tags:    tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		UserId  string `json:"userId"`
+		Updated bool   `json:"updated"`
+	}{userId, true}
+
+	return a.print(common.output, result, fieldsTable(result))
+}
+
+func runReceiptGet(a *app, args []string) error {
+	fs, common := newFlagSet("receipt get")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	receiptId, err := argument(fs.Args(), "receiptId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	receipt, err := client.GetReceipt(iaphub.GetReceiptRequest{ReceiptId: receiptId})
+	if err != nil {
+		return err
+	}
+
+	return a.print(common.output, receipt, fieldsTable(receipt))
+}
+
+func runReceiptSubmit(a *app, args []string) error {
+	fs, common := newFlagSet("receipt submit")
+	platform := fs.String("platform", "", "receipt platform: ios or android")
+	token := fs.String("token", "", "receipt token")
+	sku := fs.String("sku", "", "product sku (required for Android)")
+	context := fs.String("context", string(iaphub.ReceiptContextPurchase), "receipt context: purchase, restore or refresh")
+	prorationMode := fs.String("proration-mode", "", "proration mode (required for Android)")
+	upsert := fs.Bool("upsert", false, "create the user if it does not exist")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	userId, err := argument(fs.Args(), "userId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	update, err := client.UpdateReceipt(iaphub.UpdateReceiptRequest{
+		UserId:        userId,
+		Platform:      iaphub.Platform(*platform),
+		Token:         *token,
+		Sku:           *sku,
+		Context:       iaphub.ReceiptContext(*context),
+		ProrationMode: iaphub.ProrationMode(*prorationMode),
+		Upsert:        *upsert,
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.print(common.output, update, receiptUpdateTable(update))
+}
+
+func runPurchaseGet(a *app, args []string) error {
+	fs, common := newFlagSet("purchase get")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	purchaseId, err := argument(fs.Args(), "purchaseId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	purchase, err := client.GetPurchase(iaphub.GetPurchaseRequest{PurchaseId: purchaseId})
+	if err != nil {
+		return err
+	}
+
+	return a.print(common.output, purchase, fieldsTable(purchase))
+}
+
+// errMaxReached stops the purchase iteration once enough purchases were read
+var errMaxReached = errors.New("maximum number of purchases reached")
+
+func runPurchaseList(a *app, args []string) error {
+	fs, common := newFlagSet("purchase list")
+	var from, to timeFlag
+	fs.Var(&from, "from", "only purchases made from this date (RFC3339 or YYYY-MM-DD)")
+	fs.Var(&to, "to", "only purchases made until this date (RFC3339 or YYYY-MM-DD)")
+	order := fs.String("order", "", "order by purchase date: ask or desc")
+	user := fs.String("user", "", "IAPHUB user id")
+	userId := fs.String("user-id", "", "user id")
+	originalPurchase := fs.String("original-purchase", "", "original purchase id")
+	max := fs.Int("max", 0, "maximum number of purchases, all when 0")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError{"purchase list takes no arguments"}
+	}
+	if *order != "" && *order != string(iaphub.Ask) && *order != string(iaphub.Desc) {
+		return usageError{fmt.Sprintf("unknown order %q", *order)}
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+
+	purchases := []iaphub.Purchase{}
+	err = client.EachPurchase(iaphub.GetPurchasesRequest{
+		Order:            iaphub.Order(*order),
+		FromDate:         from.Time,
+		ToDate:           to.Time,
+		User:             *user,
+		UserId:           *userId,
+		OriginalPurchase: *originalPurchase,
+	}, func(p iaphub.Purchase) error {
+		purchases = append(purchases, p)
+		if *max > 0 && len(purchases) >= *max {
+			return errMaxReached
+		}
+		return nil
+	})
+	if err != nil && err != errMaxReached {
+		return err
+	}
+
+	return a.print(common.output, purchases, purchasesTable(purchases))
+}
+
+func runSubscriptionGet(a *app, args []string) error {
+	fs, common := newFlagSet("subscription get")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	originalPurchaseId, err := argument(fs.Args(), "originalPurchaseId")
+	if err != nil {
+		return err
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+	subscription, err := client.GetSubscription(iaphub.GetSubscriptionRequest{OriginalPurchaseId: originalPurchaseId})
+	if err != nil {
+		return err
+	}
+
+	return a.print(common.output, subscription, fieldsTable(subscription))
+}
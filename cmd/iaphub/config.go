@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	envApiKey  = "IAPHUB_API_KEY"
+	envAppId   = "IAPHUB_APP_ID"
+	envEnv     = "IAPHUB_ENV"
+	envConfig  = "IAPHUB_CONFIG"
+	envProfile = "IAPHUB_PROFILE"
+)
+
+// fileConfig is the content of the JSON config file
+type fileConfig struct {
+	ApiKey         string             `json:"apiKey"`
+	AppId          string             `json:"appId"`
+	Environment    string             `json:"environment"`
+	DefaultProfile string             `json:"defaultProfile"`
+	Profiles       map[string]profile `json:"profiles"`
+}
+
+// profile holds the settings of one app and environment.
+// The API key is never stored inline, only a reference to an environment variable or a file holding it.
+type profile struct {
+	AppId       string `json:"appId"`
+	ApiKeyEnv   string `json:"apiKeyEnv,omitempty"`
+	ApiKeyFile  string `json:"apiKeyFile,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	BaseUrl     string `json:"baseUrl,omitempty"`
+	// Only decoded to reject profiles holding a plain text key
+	ApiKey string `json:"apiKey,omitempty"`
+}
+
+// commonFlags are accepted by every command
+type commonFlags struct {
+	apiKey  string
+	appId   string
+	env     string
+	config  string
+	profile string
+	output  string
+}
+
+// settings are the resolved client settings
+type settings struct {
+	apiKey  string
+	appId   string
+	env     iaphub.Env
+	baseUrl string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	common := &commonFlags{}
+	fs.StringVar(&common.apiKey, "api-key", "", "IAPHUB API key")
+	fs.StringVar(&common.appId, "app-id", "", "IAPHUB app id")
+	fs.StringVar(&common.env, "env", "", "app environment (production by default)")
+	fs.StringVar(&common.config, "config", "", "path to the JSON config file")
+	fs.StringVar(&common.profile, "profile", "", "name of the config file profile to use")
+	fs.StringVar(&common.output, "output", outputTable, "output format: table or json")
+
+	return fs, common
+}
+
+// parseFlags parses flags placed before, between or after the arguments, which are then returned by fs.Args().
+// Everything after "--" is an argument.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return usageError{fmt.Sprintf("%s: %s", fs.Name(), err)}
+		}
+		parsed := len(args) - fs.NArg()
+		if fs.NArg() == 0 || (parsed > 0 && args[parsed-1] == "--") {
+			positional = append(positional, fs.Args()...)
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	// Parsing stops at "--", leaving the arguments in fs.Args()
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// settings resolves the client settings from flags, the selected profile, environment variables and
+// the top level of the config file, in this order of precedence.
+func (a *app) settings(common *commonFlags) (settings, error) {
+	config, err := a.loadConfig(common.config)
+	if err != nil {
+		return settings{}, err
+	}
+
+	var p profile
+	name := a.profileName(common, config)
+	if name != "" {
+		var ok bool
+		if p, ok = config.Profiles[name]; !ok {
+			return settings{}, fmt.Errorf("profile %q is not defined in the config file", name)
+		}
+	}
+
+	// The key of a selected profile never falls back to the environment or the top level of the config file,
+	// so that a command never runs against another app with a key meant for it
+	apiKey := common.apiKey
+	if apiKey == "" && name != "" {
+		if apiKey, err = a.resolveApiKey(p); err != nil {
+			return settings{}, err
+		} else if apiKey == "" && (p.ApiKeyEnv != "" || p.ApiKeyFile != "") {
+			return settings{}, usageError{fmt.Sprintf("API key referenced by profile %q is empty", name)}
+		} else if apiKey == "" {
+			return settings{}, usageError{fmt.Sprintf("profile %q has no API key, set apiKeyEnv or apiKeyFile, or use -api-key", name)}
+		}
+	} else if apiKey == "" {
+		apiKey = firstNonEmpty(a.getenv(envApiKey), config.ApiKey)
+	}
+
+	s := settings{
+		apiKey:  apiKey,
+		appId:   firstNonEmpty(common.appId, p.AppId, a.getenv(envAppId), config.AppId),
+		env:     iaphub.Env(firstNonEmpty(common.env, p.Environment, a.getenv(envEnv), config.Environment, string(iaphub.EnvProduction))),
+		baseUrl: p.BaseUrl,
+	}
+	if s.apiKey == "" || s.appId == "" {
+		return settings{}, fmt.Errorf("API key or app id is missing, use -api-key and -app-id, %s and %s, a profile or a config file", envApiKey, envAppId)
+	}
+
+	return s, nil
+}
+
+func (a *app) profileName(common *commonFlags, config fileConfig) string {
+	return firstNonEmpty(common.profile, a.getenv(envProfile), config.DefaultProfile)
+}
+
+// resolveApiKey reads the API key referenced by a profile, it returns an empty key when the profile has no reference.
+func (a *app) resolveApiKey(p profile) (string, error) {
+	if p.ApiKeyEnv != "" {
+		if key := a.getenv(p.ApiKeyEnv); key != "" {
+			return key, nil
+		}
+	}
+	if p.ApiKeyFile != "" {
+		data, err := ioutil.ReadFile(expandHome(p.ApiKeyFile))
+		if err != nil {
+			return "", fmt.Errorf("cannot read API key file: %s", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	return "", nil
+}
+
+func (a *app) loadConfig(path string) (fileConfig, error) {
+	var config fileConfig
+
+	explicit := true
+	if path == "" {
+		path = a.getenv(envConfig)
+	}
+	if path == "" {
+		explicit = false
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return config, nil
+		}
+		path = filepath.Join(dir, "iaphub", "config.json")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return config, nil
+	} else if err != nil {
+		return config, err
+	}
+
+	if err = json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %s", path, err)
+	}
+	for name, p := range config.Profiles {
+		if p.ApiKey != "" {
+			return config, fmt.Errorf("profile %q holds an inline API key, use apiKeyEnv or apiKeyFile instead", name)
+		}
+	}
+
+	return config, nil
+}
+
+func (a *app) newClient(common *commonFlags) (*iaphub.Client, error) {
+	s, err := a.settings(common)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []iaphub.Option{iaphub.UseEnv(s.env)}
+	if s.baseUrl != "" {
+		options = append(options, iaphub.UseBaseUrl(s.baseUrl))
+	}
+	if a.httpClient != nil {
+		options = append(options, iaphub.UseClient(a.httpClient))
+	}
+
+	return iaphub.NewClient(s.apiKey, s.appId, options...)
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
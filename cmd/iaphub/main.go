@@ -0,0 +1,134 @@
+// Command iaphub is a command-line client for the IAPHUB REST API.
+//
+// Usage:
+//
+//	iaphub <group> <command> [flags] [arguments]
+//
+// Credentials are read from the -api-key, -app-id and -env flags, then from the IAPHUB_API_KEY,
+// IAPHUB_APP_ID and IAPHUB_ENV environment variables, then from the JSON config file given by
+// -config or IAPHUB_CONFIG (by default iaphub/config.json in the user config directory).
+//
+// The config file can define named profiles, selected with -profile, IAPHUB_PROFILE or its defaultProfile field.
+// A profile holds the app id, environment and base URL, and refers to the API key through an environment variable
+// (apiKeyEnv) or a file (apiKeyFile); inline keys are rejected. Profile settings take precedence over the
+// environment variables, and the API key of a selected profile never falls back to IAPHUB_API_KEY:
+//
+//	{
+//	  "defaultProfile": "prod",
+//	  "profiles": {
+//	    "prod": {"appId": "app-1", "apiKeyEnv": "IAPHUB_PROD_KEY"},
+//	    "sandbox": {"appId": "app-1", "apiKeyFile": "~/.iaphub/sandbox.key", "environment": "sandbox"}
+//	  }
+//	}
+//
+// The webhook commands post generated events to a local webhook handler, authenticated with -token or
+// IAPHUB_WEBHOOK_TOKEN; they do not need API credentials.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"webhook backfill":  {"-url <url> [-token <token>] [-from <date>] [-to <date>] [-user-id <userId>] [-dry-run]", runWebhookBackfill},
+	"webhook send":      {"-url <url> [-token <token>] [-type <event type>] [-purchase <file>] [-sku <sku>] [-user-id <userId>] [-platform ios|android]", runWebhookSend},
+	"webhook lifecycle": {"-url <url> [-token <token>] [-renewals <n>] [-delay <duration>] [-purchase <file>] [-sku <sku>] [-user-id <userId>] [-platform ios|android]", runWebhookLifecycle},
+	"user get":          {"<userId> -platform ios|android [-upsert]", runUserGet},
+	"user migrate":      {"<userId>", runUserMigrate},
+	"user update":       {"<userId> -country <country> [-upsert] [-tag key=value ...]", runUserUpdate},
+	"receipt get":       {"<receiptId>", runReceiptGet},
+	"receipt submit":    {"<userId> -platform ios|android -token <token> -context purchase|restore|refresh [-sku <sku>] [-proration-mode <mode>] [-upsert]", runReceiptSubmit},
+	"purchase get":      {"<purchaseId>", runPurchaseGet},
+	"profile list":      {"", runProfileList},
+	"profile show":      {"<name>", runProfileShow},
+	"purchase list":     {"[-from <date>] [-to <date>] [-order ask|desc] [-user <user>] [-user-id <userId>] [-original-purchase <id>] [-max <n>]", runPurchaseList},
+	"subscription get":  {"<originalPurchaseId>", runSubscriptionGet},
+}
+
+type app struct {
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+	// HTTP client used for API calls, the default client when nil
+	httpClient *http.Client
+}
+
+// usageError is returned for invalid command lines, it makes the command exit with status 2.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func main() {
+	a := &app{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+	}
+	os.Exit(a.main(os.Args[1:]))
+}
+
+func (a *app) main(args []string) int {
+	err := a.run(args)
+	if err == nil {
+		return 0
+	}
+
+	fmt.Fprintln(a.stderr, "iaphub:", err)
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		a.usage()
+		return 2
+	}
+
+	return 1
+}
+
+func (a *app) run(args []string) error {
+	if len(args) == 1 && (args[0] == "help" || args[0] == "-h" || args[0] == "-help") {
+		a.usage()
+		return nil
+	} else if len(args) < 2 {
+		return usageError{"missing command"}
+	}
+
+	name := args[0] + " " + args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		return usageError{fmt.Sprintf("unknown command %q", name)}
+	}
+
+	return cmd.run(a, args[2:])
+}
+
+func (a *app) usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(a.stderr, "Usage: iaphub <group> <command> [flags] [arguments]")
+	fmt.Fprintln(a.stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(a.stderr, "  %s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(a.stderr, "\nCommon flags:")
+	fmt.Fprintln(a.stderr, "  "+strings.Join([]string{
+		"-api-key <key>", "-app-id <id>", "-env <environment>", "-config <path>", "-profile <name>", "-output table|json",
+	}, "\n  "))
+}
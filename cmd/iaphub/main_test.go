@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (r roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	return r(request)
+}
+
+func newTestApp(env map[string]string, rt roundTripper) (*app, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &app{
+		stdout: stdout,
+		stderr: stderr,
+		getenv: func(key string) string {
+			return env[key]
+		},
+		httpClient: &http.Client{Transport: rt},
+	}, stdout, stderr
+}
+
+func jsonResponse(body string) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}, nil
+}
+
+func TestApp_PurchaseGet(t *testing.T) {
+	a, stdout, _ := newTestApp(map[string]string{envApiKey: "key-1", envAppId: "app-1"}, func(req *http.Request) (*http.Response, error) {
+		expectedUrl := "https://api.iaphub.com/v1/app/app-1/purchase/purchase-1?environment=sandbox"
+		if req.URL.String() != expectedUrl {
+			return nil, fmt.Errorf("wrong URL; expected: %s, got: %s", expectedUrl, req.URL.String())
+		}
+		if req.Header.Get("Authorization") != "ApiKey key-1" {
+			return nil, fmt.Errorf("wrong auth header: %s", req.Header.Get("Authorization"))
+		}
+		return jsonResponse(`{"id":"purchase-1","productSku":"sku-1","tags":{"b":"2","a":"1"}}`)
+	})
+
+	if code := a.main([]string{"purchase", "get", "-env", "sandbox", "purchase-1"}); code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+
+	rows := map[string]string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) == 2 {
+			rows[fields[0]] = strings.TrimSpace(fields[1])
+		}
+	}
+	expectedRows := map[string]string{"id": "purchase-1", "productSku": "sku-1", "tags": "a=1, b=2"}
+	for field, value := range expectedRows {
+		if rows[field] != value {
+			t.Errorf("wrong %s row; expected: %q, got: %q", field, value, rows[field])
+		}
+	}
+}
+
+func TestApp_PurchaseListPaginatesAsJSON(t *testing.T) {
+	a, stdout, _ := newTestApp(nil, func(req *http.Request) (*http.Response, error) {
+		query := req.URL.Query()
+		if query.Get("fromDate") != "2021-01-01T00:00:00Z" || query.Get("order") != "desc" {
+			return nil, fmt.Errorf("wrong filters: %s", req.URL.RawQuery)
+		}
+		if query.Get("page") == "1" {
+			return jsonResponse(`{"hasNextPage":true,"list":[{"id":"p1"},{"id":"p2"}]}`)
+		}
+		return jsonResponse(`{"hasNextPage":false,"list":[{"id":"p3"}]}`)
+	})
+
+	code := a.main([]string{"purchase", "list", "-api-key", "key-1", "-app-id", "app-1", "-output", "json", "-from", "2021-01-01", "-order", "desc"})
+	if code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+
+	var purchases []iaphub.Purchase
+	if err := json.Unmarshal(stdout.Bytes(), &purchases); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+	var ids []string
+	for _, p := range purchases {
+		ids = append(ids, p.Id)
+	}
+	if !reflect.DeepEqual(ids, []string{"p1", "p2", "p3"}) {
+		t.Errorf("wrong purchases: %v", ids)
+	}
+}
+
+func TestApp_UserUpdateWithConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	_ = ioutil.WriteFile(configPath, []byte(`{"apiKey":"file-key","appId":"file-app","environment":"sandbox"}`), 0600)
+
+	a, _, _ := newTestApp(map[string]string{envConfig: configPath}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/v1/app/file-app/user/user-1" || req.Header.Get("Authorization") != "ApiKey file-key" {
+			return nil, fmt.Errorf("wrong request: %s", req.URL.String())
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		expectedBody := `{"userId":"user-1","country":"UA","upsert":false,"environment":"sandbox","tags":{"plan":"gold","team":"a"}}`
+		if string(body) != expectedBody {
+			return nil, fmt.Errorf("wrong body; expected: %s, got: %s", expectedBody, body)
+		}
+		return jsonResponse(`{}`)
+	})
+
+	if code := a.main([]string{"user", "update", "-country", "UA", "-tag", "plan=gold", "-tag", "team=a", "user-1"}); code != 0 {
+		t.Errorf("wrong exit code: %d", code)
+	}
+}
+
+func TestApp_FlagsAfterArguments(t *testing.T) {
+	var urls []string
+	a, _, stderr := newTestApp(map[string]string{envApiKey: "key-1", envAppId: "app-1"}, func(req *http.Request) (*http.Response, error) {
+		urls = append(urls, req.URL.String())
+		return jsonResponse(`{}`)
+	})
+
+	// Documented forms: the arguments come first
+	for _, args := range [][]string{
+		{"user", "get", "u1", "-platform", "ios", "-upsert"},
+		{"user", "get", "-env", "sandbox", "u2", "-platform", "android"},
+		{"purchase", "get", "--", "-p1"},
+	} {
+		if code := a.main(args); code != 0 {
+			t.Fatalf("wrong exit code for %v: %d, stderr: %s", args, code, stderr.String())
+		}
+	}
+
+	expected := []string{
+		"https://api.iaphub.com/v1/app/app-1/user/u1?environment=production&platform=ios&upsert=true",
+		"https://api.iaphub.com/v1/app/app-1/user/u2?environment=sandbox&platform=android",
+		"https://api.iaphub.com/v1/app/app-1/purchase/-p1?environment=production",
+	}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("wrong requests; expected:\n%v\ngot:\n%v", expected, urls)
+	}
+
+	if code := a.main([]string{"user", "get", "u1", "u2", "-platform", "ios"}); code != 2 {
+		t.Errorf("wrong exit code for extra argument: %d", code)
+	}
+}
+
+func TestApp_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"missing command", []string{"user"}, 2},
+		{"unknown command", []string{"user", "delete", "user-1"}, 2},
+		{"missing argument", []string{"purchase", "get"}, 2},
+		{"bad tag", []string{"user", "update", "-tag", "novalue", "user-1"}, 2},
+		{"missing credentials", []string{"purchase", "get", "purchase-1"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, stderr := newTestApp(map[string]string{envConfig: filepath.Join(t.TempDir(), "none.json")}, nil)
+			if code := a.main(tt.args); code != tt.code {
+				t.Errorf("wrong exit code; expected: %d, got: %d, stderr: %s", tt.code, code, stderr.String())
+			}
+		})
+	}
+}
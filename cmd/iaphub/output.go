@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// print writes v as indented JSON, or renders it with table when the table output is selected.
+func (a *app) print(output string, v interface{}, table func(w io.Writer)) error {
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case outputTable:
+		w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	default:
+		return usageError{fmt.Sprintf("unknown output format %q", output)}
+	}
+}
+
+// fieldsTable writes one "field value" row per struct field, named after its JSON field.
+func fieldsTable(v interface{}) func(w io.Writer) {
+	return func(w io.Writer) {
+		rv := reflect.ValueOf(v)
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			name := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				name = rt.Field(i).Name
+			}
+			fmt.Fprintf(w, "%s\t%s\n", name, formatValue(rv.Field(i)))
+		}
+	}
+}
+
+func purchasesTable(purchases []iaphub.Purchase) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tPURCHASE DATE\tUSER ID\tSKU\tPLATFORM\tPRICE\tCURRENCY\tREFUNDED")
+		for _, p := range purchases {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+				p.Id, formatTime(p.PurchaseDate), p.UserId, p.ProductSku, p.Platform,
+				strconv.FormatFloat(p.Price, 'f', -1, 64), p.Currency, p.IsRefunded)
+		}
+	}
+}
+
+func userTable(user iaphub.User) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "LIST\tID\tTYPE\tSKU\tPURCHASE")
+		for _, p := range user.ActiveProducts {
+			fmt.Fprintf(w, "active\t%s\t%s\t%s\t%s\n", p.Id, p.Type, p.Sku, p.Purchase)
+		}
+		for _, p := range user.ProductForSale {
+			fmt.Fprintf(w, "for sale\t%s\t%s\t%s\t%s\n", p.Id, p.Type, p.Sku, p.Purchase)
+		}
+	}
+}
+
+func receiptUpdateTable(update iaphub.ReceiptUpdate) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintf(w, "status\t%s\n\n", update.Status)
+		fmt.Fprintln(w, "TRANSACTION\tID\tSKU\tPURCHASE\tPURCHASE DATE\tEXPIRATION DATE")
+		for _, t := range update.NewTransactions {
+			fmt.Fprintf(w, "new\t%s\t%s\t%s\t%s\t%s\n", t.Id, t.Sku, t.Purchase, formatTime(t.PurchaseDate), formatTime(t.ExpirationDate))
+		}
+		for _, t := range update.OldTransactions {
+			fmt.Fprintf(w, "old\t%s\t%s\t%s\t%s\t%s\n", t.Id, t.Sku, t.Purchase, formatTime(t.PurchaseDate), formatTime(t.ExpirationDate))
+		}
+	}
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Type() == timeType {
+		return formatTime(v.Interface().(time.Time))
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		pairs := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", k, v.MapIndex(k)))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ", ")
+	case reflect.Slice:
+		items := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, formatValue(v.Index(i)))
+		}
+		return strings.Join(items, ", ")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
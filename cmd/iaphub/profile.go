@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// profileView is a profile as printed by the profile commands, with the API key redacted
+type profileView struct {
+	Name        string `json:"name"`
+	Default     bool   `json:"default"`
+	AppId       string `json:"appId"`
+	Environment string `json:"environment"`
+	BaseUrl     string `json:"baseUrl"`
+	ApiKeyFrom  string `json:"apiKeyFrom"`
+	ApiKey      string `json:"apiKey"`
+}
+
+func runProfileList(a *app, args []string) error {
+	fs, common := newFlagSet("profile list")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError{"profile list takes no arguments"}
+	}
+
+	config, err := a.loadConfig(common.config)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defaultName := a.profileName(common, config)
+	views := make([]profileView, 0, len(names))
+	for _, name := range names {
+		views = append(views, a.viewProfile(name, config.Profiles[name], name == defaultName))
+	}
+
+	return a.print(common.output, views, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tAPP ID\tENVIRONMENT\tBASE URL\tAPI KEY")
+		for _, v := range views {
+			name := v.Name
+			if v.Default {
+				name += " *"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s (%s)\n", name, v.AppId, v.Environment, v.BaseUrl, v.ApiKey, v.ApiKeyFrom)
+		}
+	})
+}
+
+func runProfileShow(a *app, args []string) error {
+	fs, common := newFlagSet("profile show")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	name, err := argument(fs.Args(), "profile name")
+	if err != nil {
+		return err
+	}
+
+	config, err := a.loadConfig(common.config)
+	if err != nil {
+		return err
+	}
+	p, ok := config.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q is not defined in the config file", name)
+	}
+
+	view := a.viewProfile(name, p, name == a.profileName(common, config))
+
+	return a.print(common.output, view, fieldsTable(view))
+}
+
+func (a *app) viewProfile(name string, p profile, isDefault bool) profileView {
+	view := profileView{
+		Name:        name,
+		Default:     isDefault,
+		AppId:       p.AppId,
+		Environment: firstNonEmpty(p.Environment, "production"),
+		BaseUrl:     p.BaseUrl,
+		ApiKeyFrom:  "none",
+		ApiKey:      "(not set)",
+	}
+	switch {
+	case p.ApiKeyEnv != "" && p.ApiKeyFile != "":
+		view.ApiKeyFrom = fmt.Sprintf("env %s, file %s", p.ApiKeyEnv, p.ApiKeyFile)
+	case p.ApiKeyEnv != "":
+		view.ApiKeyFrom = "env " + p.ApiKeyEnv
+	case p.ApiKeyFile != "":
+		view.ApiKeyFrom = "file " + p.ApiKeyFile
+	}
+
+	key, err := a.resolveApiKey(p)
+	if err != nil {
+		view.ApiKey = "(unreadable)"
+	} else if key != "" {
+		view.ApiKey = redact(key)
+	}
+
+	return view
+}
+
+// redact hides a secret, keeping the last characters of long secrets so they can be told apart
+func redact(secret string) string {
+	if len(secret) < 16 {
+		return "********"
+	}
+
+	return "********" + secret[len(secret)-4:]
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeProfilesConfig(t *testing.T) string {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "sandbox.key")
+	_ = ioutil.WriteFile(keyPath, []byte("sandbox-secret-key-0001\n"), 0600)
+
+	config := fmt.Sprintf(`{
+		"defaultProfile": "prod",
+		"profiles": {
+			"prod": {"appId": "app-prod", "apiKeyEnv": "PROD_KEY"},
+			"sandbox": {"appId": "app-sandbox", "apiKeyFile": %q, "environment": "sandbox", "baseUrl": "http://localhost:9000/v1"}
+		}
+	}`, keyPath)
+	configPath := filepath.Join(dir, "config.json")
+	_ = ioutil.WriteFile(configPath, []byte(config), 0600)
+
+	return configPath
+}
+
+func TestApp_Profiles(t *testing.T) {
+	configPath := writeProfilesConfig(t)
+
+	tests := []struct {
+		name        string
+		args        []string
+		expectedUrl string
+		expectedKey string
+	}{
+		{"default profile", []string{"purchase", "get", "p1"}, "https://api.iaphub.com/v1/app/app-prod/purchase/p1?environment=production", "prod-key"},
+		{"selected profile", []string{"purchase", "get", "-profile", "sandbox", "p1"}, "http://localhost:9000/v1/app/app-sandbox/purchase/p1?environment=sandbox", "sandbox-secret-key-0001"},
+		{"flags override profile", []string{"purchase", "get", "-profile", "sandbox", "-app-id", "app-flag", "-env", "staging", "p1"}, "http://localhost:9000/v1/app/app-flag/purchase/p1?environment=staging", "sandbox-secret-key-0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{envConfig: configPath, "PROD_KEY": "prod-key", envAppId: "app-env"}
+			a, _, stderr := newTestApp(env, func(req *http.Request) (*http.Response, error) {
+				if req.URL.String() != tt.expectedUrl {
+					return nil, fmt.Errorf("wrong URL; expected: %s, got: %s", tt.expectedUrl, req.URL.String())
+				}
+				if req.Header.Get("Authorization") != "ApiKey "+tt.expectedKey {
+					return nil, fmt.Errorf("wrong auth header: %s", req.Header.Get("Authorization"))
+				}
+				return jsonResponse(`{"id":"p1"}`)
+			})
+
+			if code := a.main(tt.args); code != 0 {
+				t.Errorf("wrong exit code: %d, stderr: %s", code, stderr.String())
+			}
+		})
+	}
+}
+
+func TestApp_ProfileList(t *testing.T) {
+	configPath := writeProfilesConfig(t)
+	a, stdout, _ := newTestApp(map[string]string{envConfig: configPath, "PROD_KEY": "short"}, nil)
+
+	if code := a.main([]string{"profile", "list", "-output", "json"}); code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+	if strings.Contains(stdout.String(), "short") || strings.Contains(stdout.String(), "sandbox-secret") {
+		t.Errorf("API key is not redacted:\n%s", stdout.String())
+	}
+
+	var views []profileView
+	if err := json.Unmarshal(stdout.Bytes(), &views); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+	expected := []profileView{
+		{Name: "prod", Default: true, AppId: "app-prod", Environment: "production", ApiKeyFrom: "env PROD_KEY", ApiKey: "********"},
+		{Name: "sandbox", AppId: "app-sandbox", Environment: "sandbox", BaseUrl: "http://localhost:9000/v1", ApiKeyFrom: "file " + filepath.Join(filepath.Dir(configPath), "sandbox.key"), ApiKey: "********0001"},
+	}
+	if !reflect.DeepEqual(views, expected) {
+		t.Errorf("wrong profiles; expected:\n%#v\ngot:\n%#v\n", expected, views)
+	}
+}
+
+func TestApp_ProfileShow(t *testing.T) {
+	configPath := writeProfilesConfig(t)
+	a, stdout, _ := newTestApp(map[string]string{envConfig: configPath}, nil)
+
+	if code := a.main([]string{"profile", "show", "sandbox"}); code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+	if !strings.Contains(stdout.String(), "app-sandbox") || strings.Contains(stdout.String(), "sandbox-secret") {
+		t.Errorf("wrong profile output:\n%s", stdout.String())
+	}
+}
+
+func TestApp_ProfileErrors(t *testing.T) {
+	dir := t.TempDir()
+	inlinePath := filepath.Join(dir, "inline.json")
+	_ = ioutil.WriteFile(inlinePath, []byte(`{"profiles":{"prod":{"appId":"app-1","apiKey":"plain"}}}`), 0600)
+	noKeyPath := filepath.Join(dir, "nokey.json")
+	_ = ioutil.WriteFile(noKeyPath, []byte(`{"apiKey":"top-level-key","profiles":{"prod":{"appId":"app-1"}}}`), 0600)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		code int
+	}{
+		{"inline key", map[string]string{envConfig: inlinePath}, []string{"profile", "list"}, 1},
+		{"unknown profile", map[string]string{envConfig: writeProfilesConfig(t)}, []string{"purchase", "get", "-profile", "staging", "p1"}, 1},
+		{"unset key env", map[string]string{envConfig: writeProfilesConfig(t), envApiKey: "other-app-key"}, []string{"purchase", "get", "p1"}, 2},
+		{"profile without key", map[string]string{envConfig: noKeyPath, envApiKey: "other-app-key"}, []string{"purchase", "get", "-profile", "prod", "p1"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestApp(tt.env, func(req *http.Request) (*http.Response, error) {
+				return nil, fmt.Errorf("unexpected request: %s", req.URL.String())
+			})
+			if code := a.main(tt.args); code != tt.code {
+				t.Errorf("wrong exit code; expected: %d, got: %d", tt.code, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+const envWebhookToken = "IAPHUB_WEBHOOK_TOKEN"
+
+// webhookFlags are the flags of the webhook commands
+type webhookFlags struct {
+	url          string
+	token        string
+	purchaseFile string
+	sku          string
+	userId       string
+	platform     string
+}
+
+// sentEvent is the result of a webhook command for one event
+type sentEvent struct {
+	Id     string            `json:"id"`
+	Type   webhook.EventType `json:"type"`
+	Status string            `json:"status"`
+	Event  webhook.Event     `json:"event"`
+}
+
+func newWebhookFlagSet(name string) (*flag.FlagSet, *commonFlags, *webhookFlags) {
+	fs, common := newFlagSet(name)
+	wf := &webhookFlags{}
+	fs.StringVar(&wf.url, "url", "", "URL of the webhook handler")
+	fs.StringVar(&wf.token, "token", "", "webhook token, "+envWebhookToken+" by default")
+	fs.StringVar(&wf.purchaseFile, "purchase", "", "JSON file of the purchase template, e.g. the output of purchase get -output json")
+	fs.StringVar(&wf.sku, "sku", "local_sku", "product sku, when there is no purchase template")
+	fs.StringVar(&wf.userId, "user-id", "local-user", "user id, when there is no purchase template")
+	fs.StringVar(&wf.platform, "platform", string(iaphub.PlatformIOS), "platform, when there is no purchase template")
+
+	return fs, common, wf
+}
+
+func runWebhookSend(a *app, args []string) error {
+	fs, common, wf := newWebhookFlagSet("webhook send")
+	eventType := fs.String("type", string(webhook.EventTypeTest), "event type")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	t, err := webhook.ParseEventType(*eventType)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+
+	template, err := a.webhookTemplate(wf)
+	if err != nil {
+		return err
+	}
+
+	return a.sendEvents(common, wf.url, wf.token, []webhook.Event{webhook.NewEvent(t, template)}, 0)
+}
+
+func runWebhookLifecycle(a *app, args []string) error {
+	fs, common, wf := newWebhookFlagSet("webhook lifecycle")
+	renewals := fs.Int("renewals", 1, "number of renewals before the cancellation")
+	delay := fs.Duration("delay", 0, "delay between events")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *renewals < 0 {
+		return usageError{"number of renewals is negative"}
+	}
+
+	template, err := a.webhookTemplate(wf)
+	if err != nil {
+		return err
+	}
+
+	return a.sendEvents(common, wf.url, wf.token, webhook.Lifecycle(template, *renewals), *delay)
+}
+
+// webhookTemplate reads the purchase template file, or builds a subscription purchase from the flags
+func (a *app) webhookTemplate(wf *webhookFlags) (iaphub.Purchase, error) {
+	var template iaphub.Purchase
+	if wf.url == "" {
+		return template, usageError{"-url is missing"}
+	}
+
+	if wf.purchaseFile != "" {
+		data, err := ioutil.ReadFile(wf.purchaseFile)
+		if err != nil {
+			return template, err
+		}
+		err = json.Unmarshal(data, &template)
+
+		return template, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	return iaphub.Purchase{
+		Id:                      "local-" + strconv.FormatInt(now.Unix(), 10),
+		PurchaseDate:            now,
+		ExpirationDate:          now.AddDate(0, 1, 0),
+		Quantity:                1,
+		Platform:                iaphub.Platform(wf.platform),
+		UserId:                  wf.userId,
+		ProductSku:              wf.sku,
+		ProductType:             iaphub.ProductTypeRenewableSubscription,
+		IsSubscription:          true,
+		IsSubscriptionActive:    true,
+		IsSubscriptionRenewable: true,
+		IsSandbox:               true,
+	}, nil
+}
+
+func runWebhookBackfill(a *app, args []string) error {
+	fs, common := newFlagSet("webhook backfill")
+	url := fs.String("url", "", "URL of the webhook handler")
+	token := fs.String("token", "", "webhook token, "+envWebhookToken+" by default")
+	var from, to timeFlag
+	fs.Var(&from, "from", "only purchases made from this date (RFC3339 or YYYY-MM-DD)")
+	fs.Var(&to, "to", "only purchases made until this date (RFC3339 or YYYY-MM-DD)")
+	userId := fs.String("user-id", "", "only purchases of this user id")
+	dryRun := fs.Bool("dry-run", false, "print the events without sending them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError{"webhook backfill takes no arguments"}
+	}
+	if *url == "" && !*dryRun {
+		return usageError{"-url is missing"}
+	}
+
+	client, err := a.newClient(common)
+	if err != nil {
+		return err
+	}
+
+	request := iaphub.GetPurchasesRequest{FromDate: from.Time, ToDate: to.Time, UserId: *userId}
+	if *dryRun {
+		backfill, err := webhook.NewBackfill(client, func(ctx context.Context, event webhook.Event) error {
+			return nil
+		}, webhook.UseDryRun())
+		if err != nil {
+			return err
+		}
+		report, err := backfill.Run(context.Background(), request)
+		if err != nil {
+			return err
+		}
+
+		return a.printEvents(common, report.Events, "dry run")
+	}
+
+	secret, err := a.webhookToken(*token)
+	if err != nil {
+		return err
+	}
+	var results []sentEvent
+	backfill, err := webhook.NewBackfill(client, func(ctx context.Context, event webhook.Event) error {
+		err := webhook.Send(a.httpClient, *url, secret, event)
+		results = append(results, sentResult(event, err))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, sendErr := backfill.Run(context.Background(), request)
+	if err := a.printResults(common, results); err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+// sendEvents posts the events in order, stopping at the first failure
+func (a *app) sendEvents(common *commonFlags, url string, token string, events []webhook.Event, delay time.Duration) error {
+	token, err := a.webhookToken(token)
+	if err != nil {
+		return err
+	}
+
+	results := make([]sentEvent, 0, len(events))
+	var sendErr error
+	for i, event := range events {
+		if i > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		sendErr = webhook.Send(a.httpClient, url, token, event)
+		results = append(results, sentResult(event, sendErr))
+		if sendErr != nil {
+			break
+		}
+	}
+
+	if err := a.printResults(common, results); err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+func (a *app) webhookToken(token string) (string, error) {
+	token = firstNonEmpty(token, a.getenv(envWebhookToken))
+	if token == "" {
+		return "", usageError{"webhook token is missing, use -token or " + envWebhookToken}
+	}
+
+	return token, nil
+}
+
+func sentResult(event webhook.Event, err error) sentEvent {
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+
+	return sentEvent{Id: event.Id, Type: event.Type, Status: status, Event: event}
+}
+
+// printEvents prints events with the same status
+func (a *app) printEvents(common *commonFlags, events []webhook.Event, status string) error {
+	results := make([]sentEvent, 0, len(events))
+	for _, event := range events {
+		results = append(results, sentEvent{Id: event.Id, Type: event.Type, Status: status, Event: event})
+	}
+
+	return a.printResults(common, results)
+}
+
+func (a *app) printResults(common *commonFlags, results []sentEvent) error {
+	return a.print(common.output, results, func(w io.Writer) {
+		fmt.Fprintln(w, "EVENT ID\tTYPE\tPURCHASE\tDATE\tSTATUS")
+		for _, r := range results {
+			purchaseId := ""
+			if r.Event.Data.Purchase != nil {
+				purchaseId = r.Event.Data.Purchase.Id
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Id, r.Type, purchaseId, formatTime(r.Event.CreatedDate), r.Status)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/n10ty/iaphub-go/webhook"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApp_WebhookLifecycle(t *testing.T) {
+	var types []webhook.EventType
+	a, stdout, _ := newTestApp(map[string]string{envWebhookToken: "secret"}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != "http://localhost:8080/webhook" || req.Header.Get(webhook.TokenHeader) != "secret" {
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+		var event webhook.Event
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			return nil, err
+		}
+		types = append(types, event.Type)
+		return jsonResponse("")
+	})
+
+	code := a.main([]string{"webhook", "lifecycle", "-url", "http://localhost:8080/webhook", "-renewals", "2", "-sku", "gold", "-output", "json"})
+	if code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+
+	expected := []webhook.EventType{
+		webhook.EventTypePurchase,
+		webhook.EventTypeSubscriptionRenewal,
+		webhook.EventTypeSubscriptionRenewal,
+		webhook.EventTypeSubscriptionCancel,
+		webhook.EventTypeSubscriptionExpire,
+	}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("wrong posted events; expected: %v, got: %v", expected, types)
+	}
+
+	var results []sentEvent
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("invalid JSON output: %s", err)
+	}
+	if len(results) != len(expected) || results[0].Status != "ok" || results[0].Event.Data.Purchase.ProductSku != "gold" {
+		t.Errorf("wrong output: %s", stdout.String())
+	}
+}
+
+func TestApp_WebhookSendErrors(t *testing.T) {
+	a, _, stderr := newTestApp(nil, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"missing url", []string{"webhook", "send", "-token", "secret"}, 2},
+		{"missing token", []string{"webhook", "send", "-url", "http://localhost"}, 2},
+		{"unknown type", []string{"webhook", "send", "-url", "http://localhost", "-token", "secret", "-type", "unknown"}, 2},
+		{"rejected", []string{"webhook", "send", "-url", "http://localhost", "-token", "wrong", "-type", "refund"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := a.main(tt.args); code != tt.code {
+				t.Errorf("wrong exit code; expected: %d, got: %d (%s)", tt.code, code, stderr.String())
+			}
+		})
+	}
+}
+
+func TestApp_WebhookBackfill(t *testing.T) {
+	var posted []string
+	a, stdout, _ := newTestApp(map[string]string{envApiKey: "key-1", envAppId: "app-1", envWebhookToken: "secret"}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "api.iaphub.com" {
+			if req.URL.Query().Get("order") != "ask" || req.URL.Query().Get("fromDate") != "2021-01-01T00:00:00Z" {
+				return nil, fmt.Errorf("wrong filters: %s", req.URL.RawQuery)
+			}
+			return jsonResponse(`{"hasNextPage":false,"list":[` +
+				`{"id":"p1","purchaseDate":"2021-01-02T00:00:00Z","isRefunded":true,"refundDate":"2021-01-05T00:00:00Z"},` +
+				`{"id":"p2","purchaseDate":"2021-01-03T00:00:00Z"}]}`)
+		}
+		var event webhook.Event
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			return nil, err
+		}
+		posted = append(posted, event.Id)
+		return jsonResponse("")
+	})
+
+	if code := a.main([]string{"webhook", "backfill", "-from", "2021-01-01", "-dry-run", "-output", "json"}); code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+	var results []sentEvent
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil || len(results) != 3 || results[0].Status != "dry run" {
+		t.Errorf("wrong dry-run output: %s", stdout.String())
+	}
+	if len(posted) != 0 {
+		t.Errorf("events were posted in dry-run mode: %v", posted)
+	}
+
+	if code := a.main([]string{"webhook", "backfill", "-from", "2021-01-01", "-url", "http://localhost:8080/webhook"}); code != 0 {
+		t.Fatalf("wrong exit code: %d", code)
+	}
+	expected := []string{"backfill-p1-purchase", "backfill-p2-purchase", "backfill-p1-refund"}
+	if !reflect.DeepEqual(posted, expected) {
+		t.Errorf("wrong posted events; expected: %v, got: %v", expected, posted)
+	}
+}
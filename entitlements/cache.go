@@ -0,0 +1,353 @@
+package entitlements
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"sync"
+	"time"
+)
+
+// Cache serves users from a Store, fetching them lazily with GetUser.
+// It implements UserGetter, so an Engine using it checks entitlements without calling the IAPHUB API on hot paths.
+//
+// A cached user is fetched again from its refresh date: after the max age, or when one of its active products expires.
+// Run refreshes users ahead of that date, and HandleEvent keeps users in sync with webhook events:
+// a user fetched while an event about it comes in is not cached.
+type Cache struct {
+	client UserGetter
+	store  Store
+	config *cacheConfig
+
+	mu sync.Mutex
+	// Cached user ids by purchase id, to find the user of events without user id
+	purchaseUsers map[string]string
+	// Purchase ids by cached user id
+	userPurchases map[string][]string
+	// Fetches in flight by user id, so that users fetched while an event comes in are not cached
+	fetches map[string]*userFetches
+}
+
+// userFetches counts the fetches of a user in flight, events increase the generation of the user
+type userFetches struct {
+	count      int
+	generation uint64
+}
+
+// NewCache returns a Cache keeping in store the users fetched with client.
+func NewCache(client UserGetter, store Store, options ...CacheOption) (*Cache, error) {
+	if client == nil {
+		return nil, errors.New("client is not specified")
+	} else if store == nil {
+		return nil, errors.New("store is not specified")
+	}
+
+	config := &cacheConfig{
+		maxAge:          time.Hour,
+		lookahead:       time.Minute,
+		refreshInterval: 30 * time.Second,
+		now:             time.Now,
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Cache{
+		client:        client,
+		store:         store,
+		config:        config,
+		purchaseUsers: map[string]string{},
+		userPurchases: map[string][]string{},
+		fetches:       map[string]*userFetches{},
+	}, nil
+}
+
+// GetUser returns the cached user, fetching it when missing or due for refresh.
+func (c *Cache) GetUser(request iaphub.GetUserRequest) (iaphub.User, error) {
+	cached, found, err := c.store.Get(request.UserId, request.Platform)
+	if err != nil {
+		return iaphub.User{}, err
+	}
+	if found && c.config.now().Before(cached.RefreshDate) {
+		return cached.User, nil
+	}
+
+	return c.fetch(request)
+}
+
+// Invalidate removes the user from the cache, it is fetched again on next use.
+func (c *Cache) Invalidate(userId string) error {
+	c.mu.Lock()
+	c.outdate(userId)
+	for _, purchaseId := range c.userPurchases[userId] {
+		delete(c.purchaseUsers, purchaseId)
+	}
+	delete(c.userPurchases, userId)
+	c.mu.Unlock()
+
+	return c.store.Delete(userId)
+}
+
+// HandleEvent is a webhook.HandlerFunc updating the cache with the user carried by the event,
+// or invalidating the users of the event: its user id, the new user id of migrations,
+// and the users owning its purchase, linked purchase or original purchase.
+func (c *Cache) HandleEvent(ctx context.Context, event webhook.Event) error {
+	if event.Type != webhook.EventTypeUserMigrate && event.Data.UserId != "" && event.Data.User != nil {
+		return c.update(event.Data.UserId, *event.Data.User)
+	}
+
+	userIds := []string{event.Data.UserId, event.Data.NewUserId}
+	if purchase := event.Data.Purchase; purchase != nil {
+		c.mu.Lock()
+		for _, purchaseId := range []string{purchase.Id, purchase.LinkedPurchase, purchase.OriginalPurchase} {
+			if userId, found := c.purchaseUsers[purchaseId]; found && purchaseId != "" {
+				userIds = append(userIds, userId)
+			}
+		}
+		c.mu.Unlock()
+		userIds = append(userIds, purchase.UserId)
+	}
+
+	for _, userId := range userIds {
+		if userId == "" {
+			continue
+		}
+		if err := c.Invalidate(userId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Refresh fetches the users due for refresh within the lookahead, and returns how many were refreshed.
+// It keeps going after a failed fetch and returns the first error.
+func (c *Cache) Refresh(ctx context.Context) (int, error) {
+	due, err := c.store.Due(c.config.now().Add(c.config.lookahead))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var firstErr error
+	for _, cached := range due {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		_, err := c.fetch(iaphub.GetUserRequest{UserId: cached.UserId, Platform: cached.Platform})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		count++
+	}
+
+	return count, firstErr
+}
+
+// Run refreshes users periodically until ctx is done.
+// Refresh errors are passed to the error handler set with UseErrorHandler, if any.
+func (c *Cache) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Refresh(ctx); err != nil && ctx.Err() == nil && c.config.onError != nil {
+			c.config.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch gets the user from the client and caches it, unless an event about the user came in the meantime
+func (c *Cache) fetch(request iaphub.GetUserRequest) (iaphub.User, error) {
+	generation := c.beginFetch(request.UserId)
+	defer c.endFetch(request.UserId)
+
+	user, err := c.client.GetUser(request)
+	if err != nil {
+		return user, err
+	}
+
+	if c.generation(request.UserId) != generation {
+		return user, nil
+	}
+	if err = c.put(request.UserId, request.Platform, user); err != nil {
+		return user, err
+	}
+	// An event came while the user was stored
+	if c.generation(request.UserId) != generation {
+		return user, c.Invalidate(request.UserId)
+	}
+
+	return user, nil
+}
+
+// beginFetch records a fetch of the user in flight and returns the generation of the user
+func (c *Cache) beginFetch(userId string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fetches, found := c.fetches[userId]
+	if !found {
+		fetches = &userFetches{}
+		c.fetches[userId] = fetches
+	}
+	fetches.count++
+
+	return fetches.generation
+}
+
+func (c *Cache) endFetch(userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fetches := c.fetches[userId]; fetches.count <= 1 {
+		delete(c.fetches, userId)
+	} else {
+		fetches.count--
+	}
+}
+
+func (c *Cache) generation(userId string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.fetches[userId].generation
+}
+
+// outdate makes the fetches of the user in flight outdated, c.mu must be held
+func (c *Cache) outdate(userId string) {
+	if fetches, found := c.fetches[userId]; found {
+		fetches.generation++
+	}
+}
+
+// update replaces the active products of the cached user on every platform
+func (c *Cache) update(userId string, user iaphub.User) error {
+	c.mu.Lock()
+	c.outdate(userId)
+	c.mu.Unlock()
+
+	for _, platform := range []iaphub.Platform{iaphub.PlatformIOS, iaphub.PlatformAndroid} {
+		cached, found, err := c.store.Get(userId, platform)
+		if err != nil {
+			return err
+		} else if !found {
+			continue
+		}
+		cached.User.ActiveProducts = user.ActiveProducts
+		if err := c.put(userId, platform, cached.User); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) put(userId string, platform iaphub.Platform, user iaphub.User) error {
+	now := c.config.now()
+	cached := CachedUser{
+		UserId:      userId,
+		Platform:    platform,
+		User:        user,
+		FetchedDate: now,
+		RefreshDate: c.refreshDate(user, now),
+	}
+
+	c.mu.Lock()
+	for _, purchaseId := range c.userPurchases[userId] {
+		delete(c.purchaseUsers, purchaseId)
+	}
+	var purchaseIds []string
+	for _, product := range user.ActiveProducts {
+		if product.Purchase != "" {
+			c.purchaseUsers[product.Purchase] = userId
+			purchaseIds = append(purchaseIds, product.Purchase)
+		}
+	}
+	c.userPurchases[userId] = purchaseIds
+	c.mu.Unlock()
+
+	return c.store.Put(cached)
+}
+
+// refreshDate returns when the user has to be fetched again: after the max age, or at the first expiration
+// of its active products, so that the user is never served past the expiration of a product.
+func (c *Cache) refreshDate(user iaphub.User, now time.Time) time.Time {
+	refreshDate := now.Add(c.config.maxAge)
+	for _, product := range user.ActiveProducts {
+		expiration := product.ExpirationDate
+		if expiration.After(now) && expiration.Before(refreshDate) {
+			refreshDate = expiration
+		}
+	}
+
+	return refreshDate
+}
+
+// UseMaxAge sets after how long cached users are fetched again (one hour by default).
+func UseMaxAge(maxAge time.Duration) CacheOption {
+	return func(c *cacheConfig) error {
+		if maxAge <= 0 {
+			return errors.New("max age must be positive")
+		}
+		c.maxAge = maxAge
+
+		return nil
+	}
+}
+
+// UseRefresh sets how often Run checks for users to refresh, and how long ahead of their refresh date
+// (every 30 seconds, one minute ahead by default). The lookahead should exceed the interval.
+func UseRefresh(interval time.Duration, lookahead time.Duration) CacheOption {
+	return func(c *cacheConfig) error {
+		if interval <= 0 || lookahead < 0 {
+			return errors.New("invalid refresh interval or lookahead")
+		}
+		c.refreshInterval = interval
+		c.lookahead = lookahead
+
+		return nil
+	}
+}
+
+// UseErrorHandler sets the func called with the errors of the refreshes done by Run.
+func UseErrorHandler(fn func(err error)) CacheOption {
+	return func(c *cacheConfig) error {
+		c.onError = fn
+
+		return nil
+	}
+}
+
+// UseCacheClock sets the clock of the cache (time.Now by default).
+func UseCacheClock(now func() time.Time) CacheOption {
+	return func(c *cacheConfig) error {
+		if now == nil {
+			return errors.New("clock is not specified")
+		}
+		c.now = now
+
+		return nil
+	}
+}
+
+type cacheConfig struct {
+	maxAge          time.Duration
+	lookahead       time.Duration
+	refreshInterval time.Duration
+	onError         func(err error)
+	now             func() time.Time
+}
+
+type CacheOption func(*cacheConfig) error
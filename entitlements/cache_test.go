@@ -0,0 +1,176 @@
+package entitlements_test
+
+import (
+	"context"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/entitlements"
+	"github.com/n10ty/iaphub-go/webhook"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	clock := now
+	calls := 0
+	products := []iaphub.Product{{Sku: "remove_ads", Purchase: "purchase-1", ExpirationDate: now.Add(10 * time.Minute)}}
+	client := userGetter(func(request iaphub.GetUserRequest) (iaphub.User, error) {
+		calls++
+		return iaphub.User{ActiveProducts: products}, nil
+	})
+	cache, err := entitlements.NewCache(client, entitlements.NewMemoryStore(),
+		entitlements.UseCacheClock(func() time.Time { return clock }),
+		entitlements.UseRefresh(30*time.Second, time.Minute))
+	if err != nil {
+		t.Fatalf("NewCache failed: %s", err)
+	}
+	request := iaphub.GetUserRequest{UserId: "user-1", Platform: iaphub.PlatformIOS}
+
+	expectCalls := func(expected int) {
+		t.Helper()
+		if calls != expected {
+			t.Errorf("wrong number of GetUser calls; expected: %d, got: %d", expected, calls)
+		}
+	}
+	expectRefresh := func(expected int) {
+		t.Helper()
+		if count, err := cache.Refresh(context.Background()); err != nil || count != expected {
+			t.Errorf("wrong refresh; expected: %d, got: %d (%v)", expected, count, err)
+		}
+	}
+
+	// Fetched lazily, once
+	_, _ = cache.GetUser(request)
+	_, _ = cache.GetUser(request)
+	expectCalls(1)
+
+	// Refreshed ahead of the expiration
+	clock = now.Add(5 * time.Minute)
+	expectRefresh(0)
+	clock = now.Add(9*time.Minute + 30*time.Second)
+	expectRefresh(1)
+	expectCalls(2)
+
+	// The expiration is within the lookahead, refreshed until it expires and fetched again at the expiration
+	expectRefresh(1)
+	expectCalls(3)
+	clock = now.Add(10 * time.Minute)
+	_, _ = cache.GetUser(request)
+	_, _ = cache.GetUser(request)
+	expectCalls(4)
+
+	// Events of the user update it
+	renewed := iaphub.User{ActiveProducts: []iaphub.Product{{Sku: "remove_ads", Purchase: "purchase-2", ExpirationDate: now.AddDate(0, 1, 0)}}}
+	err = cache.HandleEvent(context.Background(), webhook.Event{
+		Type: webhook.EventTypeSubscriptionRenewal,
+		Data: webhook.EventData{UserId: "user-1", User: &renewed},
+	})
+	if err != nil {
+		t.Errorf("HandleEvent failed: %s", err)
+	}
+	user, _ := cache.GetUser(request)
+	if user.ActiveProducts[0].Purchase != "purchase-2" {
+		t.Errorf("user was not updated: %#v", user)
+	}
+	expectCalls(4)
+
+	// Events of a known purchase invalidate its user
+	err = cache.HandleEvent(context.Background(), webhook.Event{
+		Type: webhook.EventTypeRefund,
+		Data: webhook.EventData{Purchase: &iaphub.Purchase{Id: "purchase-3", OriginalPurchase: "purchase-2"}},
+	})
+	if err != nil {
+		t.Errorf("HandleEvent failed: %s", err)
+	}
+	_, _ = cache.GetUser(request)
+	expectCalls(5)
+}
+
+func TestCache_Engine(t *testing.T) {
+	calls := 0
+	client := userGetter(func(request iaphub.GetUserRequest) (iaphub.User, error) {
+		calls++
+		return iaphub.User{ActiveProducts: []iaphub.Product{{Sku: "remove_ads", Purchase: "purchase-1"}}}, nil
+	})
+	cache, _ := entitlements.NewCache(client, entitlements.NewMemoryStore())
+	config, _ := entitlements.ParseConfig([]byte(dummyConfig))
+	engine, _ := entitlements.NewEngine(cache, config)
+
+	for i := 0; i < 3; i++ {
+		if _, ok, err := engine.Has("user-1", "no_ads"); err != nil || !ok {
+			t.Errorf("wrong no_ads entitlement: %t, %v", ok, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("wrong number of GetUser calls; expected: 1, got: %d", calls)
+	}
+
+	_ = cache.HandleEvent(context.Background(), webhook.Event{Type: webhook.EventTypeUserMigrate, Data: webhook.EventData{UserId: "user-0", NewUserId: "user-1"}})
+	_, _, _ = engine.Has("user-1", "no_ads")
+	if calls != 2 {
+		t.Errorf("user was not invalidated by the migration")
+	}
+}
+
+func TestCache_InvalidateDuringFetch(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	client := userGetter(func(request iaphub.GetUserRequest) (iaphub.User, error) {
+		calls++
+		if calls == 1 {
+			close(started)
+			<-release
+		}
+		return iaphub.User{ActiveProducts: []iaphub.Product{{Sku: "remove_ads", Purchase: "purchase-1"}}}, nil
+	})
+	cache, _ := entitlements.NewCache(client, entitlements.NewMemoryStore())
+	request := iaphub.GetUserRequest{UserId: "user-1", Platform: iaphub.PlatformIOS}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = cache.GetUser(request)
+	}()
+	<-started
+	err := cache.HandleEvent(context.Background(), webhook.Event{
+		Type: webhook.EventTypeRefund,
+		Data: webhook.EventData{UserId: "user-1", Purchase: &iaphub.Purchase{Id: "purchase-1"}},
+	})
+	if err != nil {
+		t.Errorf("HandleEvent failed: %s", err)
+	}
+	close(release)
+	<-done
+
+	// The user fetched before the event is not cached
+	_, _ = cache.GetUser(request)
+	_, _ = cache.GetUser(request)
+	if calls != 2 {
+		t.Errorf("wrong number of GetUser calls; expected: 2, got: %d", calls)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := entitlements.NewMemoryStore()
+	for _, user := range []entitlements.CachedUser{
+		{UserId: "user-1", Platform: iaphub.PlatformIOS, RefreshDate: now},
+		{UserId: "user-1", Platform: iaphub.PlatformAndroid, RefreshDate: now.Add(time.Hour)},
+		{UserId: "user-2", Platform: iaphub.PlatformIOS, RefreshDate: now},
+	} {
+		_ = store.Put(user)
+	}
+
+	if due, _ := store.Due(now); len(due) != 2 {
+		t.Errorf("wrong due users: %+v", due)
+	}
+
+	_ = store.Delete("user-1")
+	for _, platform := range []iaphub.Platform{iaphub.PlatformIOS, iaphub.PlatformAndroid} {
+		if _, found, _ := store.Get("user-1", platform); found {
+			t.Errorf("user-1 was not deleted on %s", platform)
+		}
+	}
+	if _, found, _ := store.Get("user-2", iaphub.PlatformIOS); !found {
+		t.Errorf("user-2 was deleted")
+	}
+}
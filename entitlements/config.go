@@ -0,0 +1,67 @@
+package entitlements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Config maps products to named entitlements, e.g.
+//
+//	{
+//	  "entitlements": {
+//	    "premium": {"groups": ["premium"], "skus": ["premium_lifetime"]},
+//	    "no_ads": {"skus": ["remove_ads"]}
+//	  }
+//	}
+type Config struct {
+	Entitlements map[string]Rule `json:"entitlements"`
+}
+
+// Rule lists the products granting an entitlement
+type Rule struct {
+	// SKUs of the products, whatever their type
+	Skus []string `json:"skus"`
+	// Subscription groups, by id or by name, granting the entitlement with any of their products
+	Groups []string `json:"groups"`
+	// Keep granting the entitlement while a subscription is in retry period, after a failed renewal
+	RetryPeriod bool `json:"retryPeriod"`
+}
+
+// ParseConfig parses and validates a JSON config.
+func ParseConfig(data []byte) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+// LoadConfig reads a JSON config file.
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return ParseConfig(data)
+}
+
+// Validate checks that every entitlement is granted by at least one product.
+func (c Config) Validate() error {
+	if len(c.Entitlements) == 0 {
+		return errors.New("no entitlement is configured")
+	}
+	for name, rule := range c.Entitlements {
+		if name == "" {
+			return errors.New("entitlement name is empty")
+		}
+		if len(rule.Skus) == 0 && len(rule.Groups) == 0 {
+			return fmt.Errorf("entitlement %q has no sku nor group", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package entitlements
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"sort"
+	"time"
+)
+
+// UserGetter fetches a user with their active products, it is implemented by iaphub.Client
+type UserGetter interface {
+	GetUser(request iaphub.GetUserRequest) (iaphub.User, error)
+}
+
+// Entitlement is an access granted to a user by one or several active products
+type Entitlement struct {
+	Name string
+	// Latest expiration date of the products, zero for lifetime entitlements
+	ExpirationDate time.Time
+	// Granted by a product that never expires, e.g. a non-consumable
+	Lifetime bool
+	// Granted by a subscription that will renew
+	IsRenewable bool
+	// Active products granting the entitlement
+	Products []iaphub.Product
+}
+
+// Engine resolves the entitlements of users from their active products
+type Engine struct {
+	client UserGetter
+	rules  map[string]Rule
+	config *engineConfig
+}
+
+// NewEngine returns an Engine applying the config to the users fetched with client.
+// The client can be nil when only Resolve is used.
+func NewEngine(client UserGetter, config Config, options ...Option) (*Engine, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &engineConfig{
+		platform: iaphub.PlatformIOS,
+		now:      time.Now,
+	}
+	for _, o := range options {
+		err := o(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Engine{
+		client: client,
+		rules:  config.Entitlements,
+		config: c,
+	}, nil
+}
+
+// Has fetches the user and returns the entitlement with the given name, and whether the user has it.
+func (e *Engine) Has(userId string, name string) (Entitlement, bool, error) {
+	if _, found := e.rules[name]; !found {
+		return Entitlement{}, false, errors.New("unknown entitlement " + name)
+	}
+
+	entitlements, err := e.Entitlements(userId)
+	if err != nil {
+		return Entitlement{}, false, err
+	}
+	entitlement, found := entitlements[name]
+
+	return entitlement, found, nil
+}
+
+// Entitlements fetches the user and returns their entitlements by name.
+func (e *Engine) Entitlements(userId string) (map[string]Entitlement, error) {
+	if e.client == nil {
+		return nil, errors.New("client is not specified")
+	}
+
+	user, err := e.client.GetUser(iaphub.GetUserRequest{UserId: userId, Platform: e.config.platform})
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Resolve(user), nil
+}
+
+// Resolve returns the entitlements granted by the active products of the user, by name.
+// Products expired according to the clock, paused subscriptions and, unless allowed by the rule,
+// subscriptions in retry period grant nothing.
+func (e *Engine) Resolve(user iaphub.User) map[string]Entitlement {
+	now := e.config.now()
+	entitlements := map[string]Entitlement{}
+
+	for _, product := range user.ActiveProducts {
+		for name, rule := range e.rules {
+			if !rule.matches(product) || !isActive(product, rule, now) {
+				continue
+			}
+
+			entitlement := entitlements[name]
+			entitlement.Name = name
+			entitlement.Products = append(entitlement.Products, product)
+			if product.ExpirationDate.IsZero() {
+				entitlement.Lifetime = true
+			} else if product.ExpirationDate.After(entitlement.ExpirationDate) {
+				entitlement.ExpirationDate = product.ExpirationDate
+			}
+			entitlement.IsRenewable = entitlement.IsRenewable || product.IsSubscriptionRenewable
+			entitlements[name] = entitlement
+		}
+	}
+
+	for name, entitlement := range entitlements {
+		if entitlement.Lifetime {
+			entitlement.ExpirationDate = time.Time{}
+		}
+		sort.SliceStable(entitlement.Products, func(i, j int) bool {
+			return entitlement.Products[i].Sku < entitlement.Products[j].Sku
+		})
+		entitlements[name] = entitlement
+	}
+
+	return entitlements
+}
+
+func (r Rule) matches(product iaphub.Product) bool {
+	for _, sku := range r.Skus {
+		if sku == product.Sku {
+			return true
+		}
+	}
+	if product.Group == "" && product.GroupName == "" {
+		return false
+	}
+	for _, group := range r.Groups {
+		if group == product.Group || group == product.GroupName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isActive(product iaphub.Product, rule Rule, now time.Time) bool {
+	if product.SubscriptionState == iaphub.SubscriptionStatePaused || product.SubscriptionState == iaphub.SubscriptionStateExpired {
+		return false
+	}
+	retryPeriod := product.IsSubscriptionRetryPeriod || product.SubscriptionState == iaphub.SubscriptionStateRetryPeriod
+	if retryPeriod && !rule.RetryPeriod {
+		return false
+	}
+
+	return product.ExpirationDate.IsZero() || product.ExpirationDate.After(now)
+}
+
+// UsePlatform sets the platform of the GetUser requests (iOS by default).
+// The active products of a user do not depend on it.
+func UsePlatform(platform iaphub.Platform) Option {
+	return func(c *engineConfig) error {
+		if platform == "" {
+			return errors.New("platform is not specified")
+		}
+		c.platform = platform
+
+		return nil
+	}
+}
+
+// UseClock sets the clock used to ignore expired products (time.Now by default).
+func UseClock(now func() time.Time) Option {
+	return func(c *engineConfig) error {
+		if now == nil {
+			return errors.New("clock is not specified")
+		}
+		c.now = now
+
+		return nil
+	}
+}
+
+type engineConfig struct {
+	platform iaphub.Platform
+	now      func() time.Time
+}
+
+type Option func(*engineConfig) error
@@ -0,0 +1,132 @@
+package entitlements_test
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/entitlements"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type userGetter func(request iaphub.GetUserRequest) (iaphub.User, error)
+
+func (f userGetter) GetUser(request iaphub.GetUserRequest) (iaphub.User, error) {
+	return f(request)
+}
+
+var now = time.Date(2019, 10, 20, 12, 0, 0, 0, time.UTC)
+
+const dummyConfig = `{
+  "entitlements": {
+    "premium": {"groups": ["premium"], "skus": ["premium_lifetime"]},
+    "no_ads": {"skus": ["remove_ads"], "groups": ["group-2"], "retryPeriod": true},
+    "coins": {"skus": ["coins_100"]}
+  }
+}`
+
+func TestEngine_Resolve(t *testing.T) {
+	config, err := entitlements.ParseConfig([]byte(dummyConfig))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %s", err)
+	}
+	engine, _ := entitlements.NewEngine(nil, config, entitlements.UseClock(func() time.Time { return now }))
+
+	monthly := iaphub.Product{
+		Sku:                     "premium_monthly",
+		Type:                    string(iaphub.ProductTypeRenewableSubscription),
+		GroupName:               "premium",
+		ExpirationDate:          now.AddDate(0, 0, 10),
+		IsSubscriptionRenewable: true,
+		SubscriptionState:       iaphub.SubscriptionStateActive,
+	}
+	yearly := iaphub.Product{
+		Sku:               "premium_yearly",
+		Type:              string(iaphub.ProductTypeRenewableSubscription),
+		GroupName:         "premium",
+		ExpirationDate:    now.AddDate(1, 0, 0),
+		SubscriptionState: iaphub.SubscriptionStateActive,
+	}
+	lifetime := iaphub.Product{Sku: "premium_lifetime", Type: string(iaphub.ProductTypeNonConsumable)}
+	retrying := iaphub.Product{
+		Sku:                       "ad_free_monthly",
+		Group:                     "group-2",
+		ExpirationDate:            now.AddDate(0, 0, 1),
+		IsSubscriptionRetryPeriod: true,
+		SubscriptionState:         iaphub.SubscriptionStateRetryPeriod,
+	}
+	expired := iaphub.Product{Sku: "remove_ads", ExpirationDate: now.Add(-time.Minute)}
+	paused := iaphub.Product{Sku: "premium_weekly", GroupName: "premium", SubscriptionState: iaphub.SubscriptionStatePaused}
+
+	tests := []struct {
+		name     string
+		products []iaphub.Product
+		expected map[string]entitlements.Entitlement
+	}{
+		{"none", nil, map[string]entitlements.Entitlement{}},
+		{"subscriptions of a group", []iaphub.Product{yearly, monthly}, map[string]entitlements.Entitlement{
+			"premium": {Name: "premium", ExpirationDate: yearly.ExpirationDate, IsRenewable: true, Products: []iaphub.Product{monthly, yearly}},
+		}},
+		{"lifetime", []iaphub.Product{monthly, lifetime}, map[string]entitlements.Entitlement{
+			"premium": {Name: "premium", Lifetime: true, IsRenewable: true, Products: []iaphub.Product{lifetime, monthly}},
+		}},
+		{"retry period", []iaphub.Product{retrying, expired}, map[string]entitlements.Entitlement{
+			"no_ads": {Name: "no_ads", ExpirationDate: retrying.ExpirationDate, Products: []iaphub.Product{retrying}},
+		}},
+		{"paused", []iaphub.Product{paused}, map[string]entitlements.Entitlement{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := engine.Resolve(iaphub.User{ActiveProducts: tt.products})
+			if !reflect.DeepEqual(resolved, tt.expected) {
+				t.Errorf("wrong entitlements; expected:\n%#v\ngot:\n%#v\n", tt.expected, resolved)
+			}
+		})
+	}
+}
+
+func TestEngine_Has(t *testing.T) {
+	config, _ := entitlements.ParseConfig([]byte(dummyConfig))
+	client := userGetter(func(request iaphub.GetUserRequest) (iaphub.User, error) {
+		if request.Platform != iaphub.PlatformAndroid {
+			t.Errorf("wrong platform: %s", request.Platform)
+		}
+		if request.UserId != "user-1" {
+			return iaphub.User{}, errors.New("user not found")
+		}
+		return iaphub.User{ActiveProducts: []iaphub.Product{{Sku: "remove_ads", Type: string(iaphub.ProductTypeNonConsumable)}}}, nil
+	})
+	engine, _ := entitlements.NewEngine(client, config, entitlements.UsePlatform(iaphub.PlatformAndroid))
+
+	entitlement, ok, err := engine.Has("user-1", "no_ads")
+	if err != nil || !ok || !entitlement.Lifetime {
+		t.Errorf("wrong no_ads entitlement: %#v, %t, %v", entitlement, ok, err)
+	}
+	if _, ok, err = engine.Has("user-1", "premium"); err != nil || ok {
+		t.Errorf("wrong premium entitlement: %t, %v", ok, err)
+	}
+	if _, _, err = engine.Has("user-1", "unknown"); err == nil {
+		t.Errorf("expected error for unknown entitlement")
+	}
+	if _, _, err = engine.Has("user-2", "premium"); err == nil {
+		t.Errorf("expected GetUser error")
+	}
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid JSON", `{`},
+		{"empty", `{}`},
+		{"no product", `{"entitlements":{"premium":{}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := entitlements.ParseConfig([]byte(tt.data)); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
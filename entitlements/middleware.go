@@ -0,0 +1,194 @@
+package entitlements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"net/http"
+	"time"
+)
+
+// RequireProduct returns a middleware letting requests through only when the user has the active product
+// with the given SKU, or the entitlement with the given name when an engine is set with UseEngine,
+// in which case the entitlement has to be configured.
+// The user is fetched with client, use a Cache to avoid calling the IAPHUB API on every request.
+//
+// Requests without user id are denied with 403 Forbidden, users without access with 402 Payment Required,
+// see UseDeniedHandler. Failures to fetch the user respond 502 Bad Gateway.
+// Handlers get the user and the product granting access with UserFromContext and ProductFromContext.
+func RequireProduct(client UserGetter, skuOrEntitlement string, userIdFromRequest func(*http.Request) string, options ...MiddlewareOption) (func(http.Handler) http.Handler, error) {
+	if client == nil {
+		return nil, errors.New("client is not specified")
+	} else if skuOrEntitlement == "" {
+		return nil, errors.New("sku or entitlement is not specified")
+	} else if userIdFromRequest == nil {
+		return nil, errors.New("user id func is not specified")
+	}
+
+	config := &middlewareConfig{
+		platform: func(r *http.Request) iaphub.Platform {
+			return iaphub.PlatformIOS
+		},
+		noUser:   statusHandler(http.StatusForbidden),
+		noAccess: statusHandler(http.StatusPaymentRequired),
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.engine != nil {
+		if _, found := config.engine.rules[skuOrEntitlement]; !found {
+			return nil, fmt.Errorf("entitlement %s is not configured", skuOrEntitlement)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userId := userIdFromRequest(r)
+			if userId == "" {
+				config.noUser.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := client.GetUser(iaphub.GetUserRequest{UserId: userId, Platform: config.platform(r)})
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+				return
+			}
+
+			product, ok := config.find(user, skuOrEntitlement)
+			if !ok {
+				config.noAccess.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userKey{}, user)
+			ctx = context.WithValue(ctx, productKey{}, product)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// find returns the product granting access: the one of the entitlement expiring last, or the product with the SKU
+func (c *middlewareConfig) find(user iaphub.User, skuOrEntitlement string) (iaphub.Product, bool) {
+	if c.engine != nil {
+		entitlement, ok := c.engine.Resolve(user)[skuOrEntitlement]
+		if !ok {
+			return iaphub.Product{}, false
+		}
+		granting := entitlement.Products[0]
+		for _, product := range entitlement.Products[1:] {
+			if product.ExpirationDate.IsZero() || (!granting.ExpirationDate.IsZero() && product.ExpirationDate.After(granting.ExpirationDate)) {
+				granting = product
+			}
+		}
+
+		return granting, true
+	}
+
+	now := time.Now()
+	for _, product := range user.ActiveProducts {
+		if product.Sku == skuOrEntitlement && isActive(product, Rule{}, now) {
+			return product, true
+		}
+	}
+
+	return iaphub.Product{}, false
+}
+
+type userKey struct{}
+
+type productKey struct{}
+
+// UserFromContext returns the user set by the RequireProduct middleware.
+func UserFromContext(ctx context.Context) (iaphub.User, bool) {
+	user, ok := ctx.Value(userKey{}).(iaphub.User)
+
+	return user, ok
+}
+
+// ProductFromContext returns the active product granting access, set by the RequireProduct middleware.
+func ProductFromContext(ctx context.Context) (iaphub.Product, bool) {
+	product, ok := ctx.Value(productKey{}).(iaphub.Product)
+
+	return product, ok
+}
+
+func statusHandler(code int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(code), code)
+	})
+}
+
+// UseEngine makes the middleware check the entitlement with the given name instead of a SKU.
+// RequireProduct fails if the engine does not configure the entitlement.
+func UseEngine(engine *Engine) MiddlewareOption {
+	return func(c *middlewareConfig) error {
+		if engine == nil {
+			return errors.New("engine is not specified")
+		}
+		c.engine = engine
+
+		return nil
+	}
+}
+
+// UseRequestPlatform sets the func returning the platform of the GetUser requests (iOS by default).
+func UseRequestPlatform(fn func(*http.Request) iaphub.Platform) MiddlewareOption {
+	return func(c *middlewareConfig) error {
+		if fn == nil {
+			return errors.New("platform func is not specified")
+		}
+		c.platform = fn
+
+		return nil
+	}
+}
+
+// UseDeniedStatus sets the status of the responses to users without access, e.g. 403 Forbidden (402 by default).
+func UseDeniedStatus(code int) MiddlewareOption {
+	return func(c *middlewareConfig) error {
+		if code < 400 || code > 599 {
+			return errors.New("denied status must be an error status")
+		}
+		c.noAccess = statusHandler(code)
+
+		return nil
+	}
+}
+
+// UseDeniedHandler sets the handler responding to users without access, e.g. to render a paywall.
+func UseDeniedHandler(handler http.Handler) MiddlewareOption {
+	return func(c *middlewareConfig) error {
+		if handler == nil {
+			return errors.New("denied handler is not specified")
+		}
+		c.noAccess = handler
+
+		return nil
+	}
+}
+
+// UseNoUserHandler sets the handler responding to requests without user id (403 Forbidden by default).
+func UseNoUserHandler(handler http.Handler) MiddlewareOption {
+	return func(c *middlewareConfig) error {
+		if handler == nil {
+			return errors.New("no user handler is not specified")
+		}
+		c.noUser = handler
+
+		return nil
+	}
+}
+
+type middlewareConfig struct {
+	engine   *Engine
+	platform func(*http.Request) iaphub.Platform
+	noUser   http.Handler
+	noAccess http.Handler
+}
+
+type MiddlewareOption func(*middlewareConfig) error
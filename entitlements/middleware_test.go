@@ -0,0 +1,95 @@
+package entitlements_test
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/entitlements"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireProduct(t *testing.T) {
+	monthly := iaphub.Product{Sku: "premium_monthly", GroupName: "premium", ExpirationDate: time.Now().Add(time.Hour)}
+	lifetime := iaphub.Product{Sku: "premium_lifetime"}
+	client := userGetter(func(request iaphub.GetUserRequest) (iaphub.User, error) {
+		switch request.UserId {
+		case "subscriber":
+			return iaphub.User{ActiveProducts: []iaphub.Product{monthly}}, nil
+		case "lifetime":
+			return iaphub.User{ActiveProducts: []iaphub.Product{monthly, lifetime}}, nil
+		case "free":
+			return iaphub.User{}, nil
+		}
+		return iaphub.User{}, errors.New("API failure")
+	})
+	config, _ := entitlements.ParseConfig([]byte(dummyConfig))
+	engine, _ := entitlements.NewEngine(nil, config)
+
+	var granted string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		product, _ := entitlements.ProductFromContext(r.Context())
+		if _, ok := entitlements.UserFromContext(r.Context()); !ok {
+			t.Errorf("user is not in the context")
+		}
+		granted = product.Sku
+	})
+	userId := func(r *http.Request) string {
+		return r.Header.Get("X-User-Id")
+	}
+
+	tests := []struct {
+		name             string
+		skuOrEntitlement string
+		options          []entitlements.MiddlewareOption
+		userId           string
+		expectedStatus   int
+		expectedProduct  string
+	}{
+		{"sku", "premium_monthly", nil, "subscriber", http.StatusOK, "premium_monthly"},
+		{"sku without access", "premium_lifetime", nil, "subscriber", http.StatusPaymentRequired, ""},
+		{"entitlement", "premium", []entitlements.MiddlewareOption{entitlements.UseEngine(engine)}, "subscriber", http.StatusOK, "premium_monthly"},
+		{"lifetime entitlement", "premium", []entitlements.MiddlewareOption{entitlements.UseEngine(engine)}, "lifetime", http.StatusOK, "premium_lifetime"},
+		{"no entitlement", "premium", []entitlements.MiddlewareOption{entitlements.UseEngine(engine)}, "free", http.StatusPaymentRequired, ""},
+		{"custom status", "premium", []entitlements.MiddlewareOption{entitlements.UseEngine(engine), entitlements.UseDeniedStatus(http.StatusForbidden)}, "free", http.StatusForbidden, ""},
+		{"no user", "premium_monthly", nil, "", http.StatusForbidden, ""},
+		{"API failure", "premium_monthly", nil, "unknown", http.StatusBadGateway, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require, err := entitlements.RequireProduct(client, tt.skuOrEntitlement, userId, tt.options...)
+			if err != nil {
+				t.Fatalf("RequireProduct failed: %s", err)
+			}
+
+			granted = ""
+			req := httptest.NewRequest(http.MethodGet, "/premium", nil)
+			req.Header.Set("X-User-Id", tt.userId)
+			rec := httptest.NewRecorder()
+			require(handler).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("wrong status; expected: %d, got: %d", tt.expectedStatus, rec.Code)
+			}
+			if granted != tt.expectedProduct {
+				t.Errorf("wrong product; expected: %q, got: %q", tt.expectedProduct, granted)
+			}
+		})
+	}
+}
+
+func TestRequireProduct_UnknownEntitlement(t *testing.T) {
+	client := userGetter(func(request iaphub.GetUserRequest) (iaphub.User, error) {
+		return iaphub.User{}, nil
+	})
+	config, _ := entitlements.ParseConfig([]byte(dummyConfig))
+	engine, _ := entitlements.NewEngine(nil, config)
+
+	_, err := entitlements.RequireProduct(client, "premuim", func(r *http.Request) string {
+		return "user"
+	}, entitlements.UseEngine(engine))
+	if err == nil || err.Error() != "entitlement premuim is not configured" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
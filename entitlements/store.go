@@ -0,0 +1,83 @@
+package entitlements
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"sync"
+	"time"
+)
+
+// CachedUser is a user fetched with GetUser, kept by a Store
+type CachedUser struct {
+	UserId      string          `json:"userId"`
+	Platform    iaphub.Platform `json:"platform"`
+	User        iaphub.User     `json:"user"`
+	FetchedDate time.Time       `json:"fetchedDate"`
+	// Date from which the user has to be fetched again
+	RefreshDate time.Time `json:"refreshDate"`
+}
+
+// Store keeps cached users by user id and platform
+type Store interface {
+	Get(userId string, platform iaphub.Platform) (CachedUser, bool, error)
+	Put(user CachedUser) error
+	// Delete removes the user for every platform
+	Delete(userId string) error
+	// Due returns the users to refresh by the date
+	Due(date time.Time) ([]CachedUser, error)
+}
+
+type MemoryStore struct {
+	mu sync.RWMutex
+	// Cached users by user id, then platform
+	users map[string]map[iaphub.Platform]CachedUser
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users: map[string]map[iaphub.Platform]CachedUser{},
+	}
+}
+
+func (s *MemoryStore) Get(userId string, platform iaphub.Platform) (CachedUser, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[userId][platform]
+
+	return user, ok, nil
+}
+
+func (s *MemoryStore) Put(user CachedUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	platforms, ok := s.users[user.UserId]
+	if !ok {
+		platforms = map[iaphub.Platform]CachedUser{}
+		s.users[user.UserId] = platforms
+	}
+	platforms[user.Platform] = user
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, userId)
+
+	return nil
+}
+
+func (s *MemoryStore) Due(date time.Time) ([]CachedUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var due []CachedUser
+	for _, platforms := range s.users {
+		for _, user := range platforms {
+			if !user.RefreshDate.After(date) {
+				due = append(due, user)
+			}
+		}
+	}
+
+	return due, nil
+}
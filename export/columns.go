@@ -0,0 +1,141 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column is a single CSV column extracted from a purchase
+type Column struct {
+	Name  string
+	Value func(p iaphub.Purchase) string
+}
+
+const tagColumnPrefix = "tags."
+
+var defaultColumns = []Column{
+	{"id", func(p iaphub.Purchase) string { return p.Id }},
+	{"purchaseDate", func(p iaphub.Purchase) string { return formatTime(p.PurchaseDate) }},
+	{"quantity", func(p iaphub.Purchase) string { return strconv.Itoa(p.Quantity) }},
+	{"platform", func(p iaphub.Purchase) string { return string(p.Platform) }},
+	{"country", func(p iaphub.Purchase) string { return p.Country }},
+	{"tags", func(p iaphub.Purchase) string { return formatTags(p.Tags) }},
+	{"orderId", func(p iaphub.Purchase) string { return p.OrderId }},
+	{"app", func(p iaphub.Purchase) string { return p.App }},
+	{"user", func(p iaphub.Purchase) string { return p.User }},
+	{"userId", func(p iaphub.Purchase) string { return p.UserId }},
+	{"userIds", func(p iaphub.Purchase) string { return strings.Join(p.UserIds, ";") }},
+	{"receipt", func(p iaphub.Purchase) string { return p.Receipt }},
+	{"androidToken", func(p iaphub.Purchase) string { return p.AndroidToken }},
+	{"product", func(p iaphub.Purchase) string { return p.Product }},
+	{"productSku", func(p iaphub.Purchase) string { return p.ProductSku }},
+	{"productType", func(p iaphub.Purchase) string { return string(p.ProductType) }},
+	{"productGroupName", func(p iaphub.Purchase) string { return p.ProductGroupName }},
+	{"listing", func(p iaphub.Purchase) string { return p.Listing }},
+	{"store", func(p iaphub.Purchase) string { return p.Store }},
+	{"storeSegmentIndex", func(p iaphub.Purchase) string { return strconv.Itoa(p.StoreSegmentIndex) }},
+	{"currency", func(p iaphub.Purchase) string { return p.Currency }},
+	{"price", func(p iaphub.Purchase) string { return formatFloat(p.Price) }},
+	{"convertedCurrency", func(p iaphub.Purchase) string { return p.ConvertedCurrency }},
+	{"convertedPrice", func(p iaphub.Purchase) string { return formatFloat(p.ConvertedPrice) }},
+	{"isSandbox", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsSandbox) }},
+	{"isFamilyShare", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsFamilyShare) }},
+	{"isPromo", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsPromo) }},
+	{"isRefunded", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsRefunded) }},
+	{"refundDate", func(p iaphub.Purchase) string { return formatTime(p.RefundDate) }},
+	{"refundReason", func(p iaphub.Purchase) string { return string(p.RefundReason) }},
+	{"refundAmount", func(p iaphub.Purchase) string { return formatFloat(p.RefundAmount) }},
+	{"convertedRefundAmount", func(p iaphub.Purchase) string { return formatFloat(p.ConvertedRefundAmount) }},
+	{"isSubscription", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsSubscription) }},
+	{"isSubscriptionActive", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsSubscriptionActive) }},
+	{"isSubscriptionRenewable", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsSubscriptionRenewable) }},
+	{"isSubscriptionRetryPeriod", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsSubscriptionRetryPeriod) }},
+	{"isSubscriptionGracePeriod", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsSubscriptionGracePeriod) }},
+	{"isTrialConversion", func(p iaphub.Purchase) string { return strconv.FormatBool(p.IsTrialConversion) }},
+	{"subscriptionState", func(p iaphub.Purchase) string { return string(p.SubscriptionState) }},
+	{"subscriptionPeriodType", func(p iaphub.Purchase) string { return string(p.SubscriptionPeriodType) }},
+	{"subscriptionCancelReason", func(p iaphub.Purchase) string { return string(p.SubscriptionCancelReason) }},
+	{"subscriptionProrationMode", func(p iaphub.Purchase) string { return string(p.SubscriptionProrationMode) }},
+	{"subscriptionRenewalProduct", func(p iaphub.Purchase) string { return p.SubscriptionRenewalProduct }},
+	{"subscriptionRenewalProductSku", func(p iaphub.Purchase) string { return p.SubscriptionRenewalProductSku }},
+	{"expirationDate", func(p iaphub.Purchase) string { return formatTime(p.ExpirationDate) }},
+	{"autoResumeDate", func(p iaphub.Purchase) string { return formatTime(p.AutoResumeDate) }},
+	{"nextPurchase", func(p iaphub.Purchase) string { return p.NextPurchase }},
+	{"linkedPurchase", func(p iaphub.Purchase) string { return p.LinkedPurchase }},
+	{"originalPurchase", func(p iaphub.Purchase) string { return p.OriginalPurchase }},
+}
+
+// DefaultColumns returns every purchase field in a stable order, named after the API fields.
+// Tags are written to a single "tags" column as a JSON object.
+func DefaultColumns() []Column {
+	columns := make([]Column, len(defaultColumns))
+	copy(columns, defaultColumns)
+
+	return columns
+}
+
+// Columns returns the columns with the given names, in the given order.
+// Besides the default column names, "tags.<key>" selects the value of a single tag.
+func Columns(names ...string) ([]Column, error) {
+	columns := make([]Column, 0, len(names))
+	for _, name := range names {
+		if strings.HasPrefix(name, tagColumnPrefix) {
+			columns = append(columns, TagColumn(strings.TrimPrefix(name, tagColumnPrefix)))
+			continue
+		}
+
+		column, ok := findColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// TagColumn returns a column named "tags.<key>" holding the value of one tag.
+func TagColumn(key string) Column {
+	return Column{
+		Name: tagColumnPrefix + key,
+		Value: func(p iaphub.Purchase) string {
+			return p.Tags[key]
+		},
+	}
+}
+
+func findColumn(name string) (Column, bool) {
+	for _, column := range defaultColumns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+
+	return Column{}, false
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatTags writes the tags as a JSON object with sorted keys, so that keys and values may hold any character
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(tags)
+
+	return string(data)
+}
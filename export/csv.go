@@ -0,0 +1,73 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"io"
+)
+
+// CSVWriter writes purchases as CSV rows, preceded by a header row with the column names.
+type CSVWriter struct {
+	w             *csv.Writer
+	columns       []Column
+	headerWritten bool
+}
+
+// NewCSVWriter creates a CSV writer with the given columns, or DefaultColumns when none are given.
+func NewCSVWriter(w io.Writer, columns ...Column) (*CSVWriter, error) {
+	if w == nil {
+		return nil, errors.New("writer is not specified")
+	}
+	if len(columns) == 0 {
+		columns = DefaultColumns()
+	}
+	for _, column := range columns {
+		if column.Name == "" || column.Value == nil {
+			return nil, errors.New("column name or value is missing")
+		}
+	}
+
+	return &CSVWriter{
+		w:       csv.NewWriter(w),
+		columns: columns,
+	}, nil
+}
+
+// Write writes a single purchase. It can be passed directly to Client.EachPurchase.
+func (cw *CSVWriter) Write(purchase iaphub.Purchase) error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cw.columns))
+	for i, column := range cw.columns {
+		record[i] = column.Value(purchase)
+	}
+
+	return cw.w.Write(record)
+}
+
+// Flush writes the header if no purchase was written and flushes buffered rows to the underlying writer.
+func (cw *CSVWriter) Flush() error {
+	if err := cw.writeHeader(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+
+	return cw.w.Error()
+}
+
+func (cw *CSVWriter) writeHeader() error {
+	if cw.headerWritten {
+		return nil
+	}
+	cw.headerWritten = true
+
+	header := make([]string, len(cw.columns))
+	for i, column := range cw.columns {
+		header[i] = column.Name
+	}
+
+	return cw.w.Write(header)
+}
@@ -0,0 +1,125 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/export"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVWriter(t *testing.T) {
+	columns, err := export.Columns("id", "purchaseDate", "price", "isRefunded", "refundDate", "tags", "tags.campaign", "tags.missing")
+	if err != nil {
+		t.Fatalf("Columns failed: %s", err)
+	}
+
+	var buf bytes.Buffer
+	writer, _ := export.NewCSVWriter(&buf, columns...)
+
+	if err := writer.Write(dummyPurchase()); err != nil {
+		t.Errorf("Write failed: %s", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Errorf("Flush failed: %s", err)
+	}
+
+	expected := "id,purchaseDate,price,isRefunded,refundDate,tags,tags.campaign,tags.missing\n" +
+		"purchase-1,2019-10-12T17:34:33Z,19.99,false,,\"{\"\"campaign\"\":\"\"summer,sale;b=2\"\",\"\"source\"\":\"\"ads\"\"}\",\"summer,sale;b=2\",\n"
+	if buf.String() != expected {
+		t.Errorf("wrong CSV; expected:\n%s\ngot:\n%s\n", expected, buf.String())
+	}
+}
+
+func TestCSVWriterDefaultColumns(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _ := export.NewCSVWriter(&buf)
+	if err := writer.Flush(); err != nil {
+		t.Errorf("Flush failed: %s", err)
+	}
+
+	header := strings.TrimSpace(buf.String())
+	if !strings.HasPrefix(header, "id,purchaseDate,quantity,platform,") || !strings.HasSuffix(header, ",originalPurchase") {
+		t.Errorf("wrong default header: %s", header)
+	}
+	if len(strings.Split(header, ",")) != len(export.DefaultColumns()) {
+		t.Errorf("wrong number of default columns: %s", header)
+	}
+}
+
+func TestColumnsUnknown(t *testing.T) {
+	if _, err := export.Columns("id", "unknown"); err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _ := export.NewJSONLWriter(&buf)
+
+	purchases := []iaphub.Purchase{dummyPurchase(), dummyPurchase()}
+	purchases[1].Id = "purchase-2"
+	for _, p := range purchases {
+		if err := writer.Write(p); err != nil {
+			t.Errorf("Write failed: %s", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(purchases) {
+		t.Fatalf("wrong number of lines; expected: %d, got: %d", len(purchases), len(lines))
+	}
+	for i, line := range lines {
+		var actual iaphub.Purchase
+		if err := json.Unmarshal([]byte(line), &actual); err != nil {
+			t.Errorf("invalid JSON line %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(purchases[i], actual) {
+			t.Errorf("wrong purchase; expected:\n%#v\ngot:\n%#v\n", purchases[i], actual)
+		}
+	}
+}
+
+func TestJSONLReader(t *testing.T) {
+	var buf bytes.Buffer
+	writer, _ := export.NewJSONLWriter(&buf)
+	purchases := []iaphub.Purchase{dummyPurchase(), dummyPurchase()}
+	purchases[1].Id = "purchase-2"
+	for _, p := range purchases {
+		_ = writer.Write(p)
+	}
+
+	reader, _ := export.NewJSONLReader(&buf)
+	var actual []iaphub.Purchase
+	err := reader.Each(func(p iaphub.Purchase) error {
+		actual = append(actual, p)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Each failed: %s", err)
+	}
+	if !reflect.DeepEqual(purchases, actual) {
+		t.Errorf("wrong purchases; expected:\n%#v\ngot:\n%#v\n", purchases, actual)
+	}
+
+	reader, _ = export.NewJSONLReader(strings.NewReader(`{"id":"purchase-1"}` + "\n{"))
+	if err := reader.Each(func(p iaphub.Purchase) error { return nil }); err == nil {
+		t.Errorf("expected error for truncated line")
+	}
+}
+
+func dummyPurchase() iaphub.Purchase {
+	purchaseDate, _ := time.Parse(time.RFC3339, "2019-10-12T17:34:33.256Z")
+	return iaphub.Purchase{
+		Id:           "purchase-1",
+		PurchaseDate: purchaseDate,
+		Price:        19.99,
+		Tags: map[string]string{
+			"source":   "ads",
+			"campaign": "summer,sale;b=2",
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"io"
+)
+
+// JSONLWriter writes purchases as JSON Lines, one API formatted purchase per line.
+type JSONLWriter struct {
+	encoder *json.Encoder
+}
+
+func NewJSONLWriter(w io.Writer) (*JSONLWriter, error) {
+	if w == nil {
+		return nil, errors.New("writer is not specified")
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	return &JSONLWriter{encoder: encoder}, nil
+}
+
+// Write writes a single purchase. It can be passed directly to Client.EachPurchase.
+func (jw *JSONLWriter) Write(purchase iaphub.Purchase) error {
+	return jw.encoder.Encode(purchase)
+}
+
+// JSONLReader reads purchases written by a JSONLWriter.
+type JSONLReader struct {
+	decoder *json.Decoder
+}
+
+func NewJSONLReader(r io.Reader) (*JSONLReader, error) {
+	if r == nil {
+		return nil, errors.New("reader is not specified")
+	}
+
+	return &JSONLReader{decoder: json.NewDecoder(r)}, nil
+}
+
+// Read reads the next purchase, it returns io.EOF after the last one.
+func (jr *JSONLReader) Read() (iaphub.Purchase, error) {
+	var purchase iaphub.Purchase
+	err := jr.decoder.Decode(&purchase)
+
+	return purchase, err
+}
+
+// Each calls fn for every remaining purchase, stopping at the first error.
+func (jr *JSONLReader) Each(fn func(iaphub.Purchase) error) error {
+	for {
+		purchase, err := jr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(purchase); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package iaphub
+
+import "time"
+
+// CustomerId returns the id of the customer of the purchase: its user id, or the IAPHUB user id when not set.
+func (p Purchase) CustomerId() string {
+	if p.UserId != "" {
+		return p.UserId
+	}
+
+	return p.User
+}
+
+// IsLifetime reports whether the purchase never expires, e.g. a non-consumable.
+func (p Purchase) IsLifetime() bool {
+	if p.ProductType != "" {
+		return p.ProductType == ProductTypeNonConsumable
+	}
+
+	return !p.IsSubscription && p.ExpirationDate.IsZero()
+}
+
+// IsActiveAt reports whether the purchase grants access at t: it was made and not refunded by then,
+// and it is lifetime or not expired. Consumables are never active.
+func (p Purchase) IsActiveAt(t time.Time) bool {
+	if p.ProductType == ProductTypeConsumable || p.PurchaseDate.After(t) || p.IsRefundedAt(t) {
+		return false
+	}
+	if p.IsLifetime() {
+		return true
+	}
+
+	return p.ExpirationDate.After(t)
+}
+
+// IsRefundedAt reports whether the purchase was refunded at t. Refunds without date count from the purchase.
+func (p Purchase) IsRefundedAt(t time.Time) bool {
+	if !p.IsRefunded {
+		return false
+	}
+
+	return p.RefundDate.IsZero() || !p.RefundDate.After(t)
+}
+
+// IsPausedAt reports whether the subscription is paused at t, between its expiration and its auto resume date.
+func (p Purchase) IsPausedAt(t time.Time) bool {
+	return isPausedAt(p.ExpirationDate, p.AutoResumeDate, t)
+}
+
+// RemainingTime returns the time left before the expiration, 0 when expired or without expiration date.
+func (p Purchase) RemainingTime(now time.Time) time.Duration {
+	if p.IsRefundedAt(now) {
+		return 0
+	}
+
+	return remainingTime(p.ExpirationDate, now)
+}
+
+// InTrial reports whether the subscription period is a free trial.
+func (p Purchase) InTrial() bool {
+	return p.SubscriptionPeriodType == SubscriptionPeriodTypeTrial
+}
+
+// InIntro reports whether the subscription period is at an introductory price.
+func (p Purchase) InIntro() bool {
+	return p.SubscriptionPeriodType == SubscriptionPeriodTypeIntro
+}
+
+// WillRenew reports whether the subscription renews at the end of the period.
+func (p Purchase) WillRenew() bool {
+	return p.IsSubscription && p.IsSubscriptionRenewable && !p.IsRefunded && p.SubscriptionState != SubscriptionStateExpired
+}
+
+// NetPrice returns the price minus the refunded amount. Refunds without amount refund the whole price.
+func (p Purchase) NetPrice() float64 {
+	return netPrice(p.IsRefunded, p.Price, p.RefundAmount)
+}
+
+// ConvertedNetPrice returns the converted price minus the converted refunded amount.
+func (p Purchase) ConvertedNetPrice() float64 {
+	return netPrice(p.IsRefunded, p.ConvertedPrice, p.ConvertedRefundAmount)
+}
+
+// IsLifetime reports whether the transaction never expires.
+func (t Transaction) IsLifetime() bool {
+	return t.ExpirationDate.IsZero()
+}
+
+// IsActiveAt reports whether the transaction was made by at and is lifetime or not expired.
+func (t Transaction) IsActiveAt(at time.Time) bool {
+	if t.PurchaseDate.After(at) {
+		return false
+	}
+
+	return t.IsLifetime() || t.ExpirationDate.After(at)
+}
+
+// IsPausedAt reports whether the subscription is paused at the time, between its expiration and its auto resume date.
+func (t Transaction) IsPausedAt(at time.Time) bool {
+	return isPausedAt(t.ExpirationDate, t.AutoResumeDate, at)
+}
+
+// RemainingTime returns the time left before the expiration, 0 when expired or without expiration date.
+func (t Transaction) RemainingTime(now time.Time) time.Duration {
+	return remainingTime(t.ExpirationDate, now)
+}
+
+// InTrial reports whether the subscription period is a free trial.
+func (t Transaction) InTrial() bool {
+	return t.SubscriptionPeriodType == SubscriptionPeriodTypeTrial
+}
+
+// InIntro reports whether the subscription period is at an introductory price.
+func (t Transaction) InIntro() bool {
+	return t.SubscriptionPeriodType == SubscriptionPeriodTypeIntro
+}
+
+// WillRenew reports whether the subscription renews at the end of the period.
+func (t Transaction) WillRenew() bool {
+	return t.IsSubscriptionRenewable && !t.ExpirationDate.IsZero()
+}
+
+func isPausedAt(expiration time.Time, autoResume time.Time, t time.Time) bool {
+	if expiration.IsZero() || autoResume.IsZero() {
+		return false
+	}
+
+	return !expiration.After(t) && autoResume.After(t)
+}
+
+func remainingTime(expiration time.Time, now time.Time) time.Duration {
+	if expiration.IsZero() || !expiration.After(now) {
+		return 0
+	}
+
+	return expiration.Sub(now)
+}
+
+func netPrice(refunded bool, price float64, refundAmount float64) float64 {
+	if !refunded {
+		return price
+	}
+	if refundAmount == 0 || refundAmount > price {
+		return 0
+	}
+
+	return price - refundAmount
+}
@@ -0,0 +1,90 @@
+package iaphub_test
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"testing"
+	"time"
+)
+
+func TestPurchase_Helpers(t *testing.T) {
+	now := time.Date(2019, 10, 20, 12, 0, 0, 0, time.UTC)
+	subscription := iaphub.Purchase{
+		ProductType:             iaphub.ProductTypeRenewableSubscription,
+		IsSubscription:          true,
+		IsSubscriptionRenewable: true,
+		PurchaseDate:            now.AddDate(0, 0, -10),
+		ExpirationDate:          now.AddDate(0, 0, 20),
+		SubscriptionPeriodType:  iaphub.SubscriptionPeriodTypeTrial,
+		Price:                   9.99,
+		ConvertedPrice:          8.5,
+	}
+	refunded := subscription
+	refunded.IsRefunded = true
+	refunded.RefundDate = now.AddDate(0, 0, -1)
+	refunded.RefundAmount = 4
+	refunded.ConvertedRefundAmount = 3.5
+	lifetime := iaphub.Purchase{ProductType: iaphub.ProductTypeNonConsumable, PurchaseDate: now.AddDate(-1, 0, 0), Price: 20}
+	paused := subscription
+	paused.ExpirationDate = now.AddDate(0, 0, -2)
+	paused.AutoResumeDate = now.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"subscription active", subscription.IsActiveAt(now), true},
+		{"subscription not yet purchased", subscription.IsActiveAt(now.AddDate(0, 0, -11)), false},
+		{"subscription expired", subscription.IsActiveAt(now.AddDate(0, 1, 0)), false},
+		{"subscription remaining time", subscription.RemainingTime(now), 20 * 24 * time.Hour},
+		{"subscription in trial", subscription.InTrial(), true},
+		{"subscription will renew", subscription.WillRenew(), true},
+		{"subscription net price", subscription.NetPrice(), 9.99},
+		{"refunded inactive", refunded.IsActiveAt(now), false},
+		{"refunded active before refund", refunded.IsActiveAt(now.AddDate(0, 0, -2)), true},
+		{"refunded remaining time", refunded.RemainingTime(now), time.Duration(0)},
+		{"refunded will not renew", refunded.WillRenew(), false},
+		{"refunded net price", refunded.NetPrice(), 5.99},
+		{"refunded converted net price", refunded.ConvertedNetPrice(), 5.0},
+		{"lifetime", lifetime.IsLifetime(), true},
+		{"lifetime active", lifetime.IsActiveAt(now.AddDate(10, 0, 0)), true},
+		{"lifetime remaining time", lifetime.RemainingTime(now), time.Duration(0)},
+		{"paused", paused.IsPausedAt(now), true},
+		{"paused after resume", paused.IsPausedAt(now.AddDate(0, 2, 0)), false},
+		{"not paused", subscription.IsPausedAt(now), false},
+		{"consumable", iaphub.Purchase{ProductType: iaphub.ProductTypeConsumable}.IsActiveAt(now), false},
+		{"full refund without amount", iaphub.Purchase{Price: 3, IsRefunded: true}.NetPrice(), 0.0},
+		{"customer id", iaphub.Purchase{User: "u-iaphub", UserId: "u-app"}.CustomerId(), "u-app"},
+		{"customer id without user id", iaphub.Purchase{User: "u-iaphub"}.CustomerId(), "u-iaphub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("wrong result; expected: %v, got: %v", tt.expected, tt.got)
+			}
+		})
+	}
+}
+
+func TestTransaction_Helpers(t *testing.T) {
+	now := time.Date(2019, 10, 20, 12, 0, 0, 0, time.UTC)
+	transaction := iaphub.Transaction{
+		PurchaseDate:            now.AddDate(0, 0, -1),
+		ExpirationDate:          now.Add(time.Hour),
+		IsSubscriptionRenewable: true,
+		SubscriptionPeriodType:  iaphub.SubscriptionPeriodTypeIntro,
+	}
+
+	if !transaction.IsActiveAt(now) || transaction.IsActiveAt(now.Add(2*time.Hour)) {
+		t.Errorf("wrong activity")
+	}
+	if remaining := transaction.RemainingTime(now); remaining != time.Hour {
+		t.Errorf("wrong remaining time; expected: %s, got: %s", time.Hour, remaining)
+	}
+	if !transaction.InIntro() || transaction.InTrial() || !transaction.WillRenew() || transaction.IsLifetime() {
+		t.Errorf("wrong period predicates")
+	}
+	if lifetime := (iaphub.Transaction{PurchaseDate: now}); !lifetime.IsLifetime() || !lifetime.IsActiveAt(now.AddDate(5, 0, 0)) {
+		t.Errorf("wrong lifetime transaction")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -44,10 +45,11 @@ const (
 )
 
 type Client struct {
-	apiKey string
-	appId  string
-	client *http.Client
-	env    Env
+	apiKey  string
+	appId   string
+	client  *http.Client
+	env     Env
+	baseUrl string
 }
 
 func NewClient(apiKey string, appId string, options ...Option) (*Client, error) {
@@ -55,6 +57,7 @@ func NewClient(apiKey string, appId string, options ...Option) (*Client, error)
 		requestTimeout: 3 * time.Second,
 		client:         http.DefaultClient,
 		env:            EnvProduction,
+		baseUrl:        ApiUrl,
 	}
 
 	for _, o := range options {
@@ -65,15 +68,16 @@ func NewClient(apiKey string, appId string, options ...Option) (*Client, error)
 	}
 
 	return &Client{
-		apiKey: apiKey,
-		appId:  appId,
-		client: config.client,
-		env:    config.env,
+		apiKey:  apiKey,
+		appId:   appId,
+		client:  config.client,
+		env:     config.env,
+		baseUrl: config.baseUrl,
 	}, nil
 }
 
 func (c *Client) requestGet(path string, queryParams map[string]string) ([]byte, error) {
-	fpath := ApiUrl + path
+	fpath := c.baseUrl + path
 
 	request, err := c.newRequest(http.MethodGet, fpath, queryParams, nil)
 	if err != nil {
@@ -104,7 +108,7 @@ func (c *Client) requestGet(path string, queryParams map[string]string) ([]byte,
 }
 
 func (c *Client) requestPost(path string, queryParams map[string]string, data interface{}) ([]byte, error) {
-	fpath := ApiUrl + path
+	fpath := c.baseUrl + path
 
 	request, err := c.newRequest(http.MethodPost, fpath, queryParams, data)
 	if err != nil {
@@ -193,10 +197,26 @@ func UseEnv(env Env) Option {
 	}
 }
 
+// UseBaseUrl sets the API base URL, e.g. for a proxy or a mock server.
+func UseBaseUrl(baseUrl string) Option {
+	return func(c *config) error {
+		u, err := url.Parse(baseUrl)
+		if err != nil {
+			return err
+		} else if u.Scheme == "" || u.Host == "" {
+			return errors.New("base URL must be absolute")
+		}
+		c.baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+		return nil
+	}
+}
+
 type config struct {
 	requestTimeout time.Duration
 	client         *http.Client
 	env            Env
+	baseUrl        string
 }
 
 type Option func(*config) error
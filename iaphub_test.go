@@ -0,0 +1,51 @@
+package iaphub_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestUseBaseUrl(t *testing.T) {
+	httpClient := newClient(
+		func(req *http.Request) (*http.Response, error) {
+			expectedUrl := fmt.Sprintf("http://localhost:8080/iaphub/app/%s/user/%s?environment=sandbox&platform=ios", appId1, userId1)
+			if req.URL.String() != expectedUrl {
+				return nil, fmt.Errorf("wrong URL; expected: %s, got: %s", expectedUrl, req.URL.String())
+			}
+
+			body, _ := json.Marshal(dummyUser())
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewBuffer(body)),
+			}, nil
+		},
+	)
+
+	client, err := iaphub.NewClient(
+		apiKey1,
+		appId1,
+		iaphub.UseClient(httpClient),
+		iaphub.UseEnv(iaphub.Env(env)),
+		iaphub.UseBaseUrl("http://localhost:8080/iaphub/"),
+	)
+	if err != nil {
+		t.Fatalf("NewClient failed: %s", err)
+	}
+
+	_, err = client.GetUser(iaphub.GetUserRequest{UserId: userId1, Platform: iaphub.PlatformIOS})
+	if err != nil {
+		t.Errorf("GetUser failed: %s", err)
+	}
+}
+
+func TestUseBaseUrlInvalid(t *testing.T) {
+	_, err := iaphub.NewClient(apiKey1, appId1, iaphub.UseBaseUrl("/relative"))
+	if err == nil {
+		t.Errorf("expected error for relative base URL")
+	}
+}
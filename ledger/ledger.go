@@ -0,0 +1,219 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"time"
+)
+
+// Ledger turns consumable purchases into credits.
+// A purchase is granted its credits once and reversed once when refunded, whatever the number of times it is seen
+// through webhooks or synchronization.
+type Ledger struct {
+	store   Store
+	credits map[string]int64
+	config  *ledgerConfig
+}
+
+// NewLedger returns a Ledger recording entries in store, granting credits per unit of the consumable SKUs.
+func NewLedger(store Store, credits map[string]int64, options ...Option) (*Ledger, error) {
+	if store == nil {
+		return nil, errors.New("store is not specified")
+	} else if len(credits) == 0 {
+		return nil, errors.New("credits are not specified")
+	}
+	for sku, amount := range credits {
+		if amount <= 0 {
+			return nil, fmt.Errorf("credits of sku %s are not positive", sku)
+		}
+	}
+
+	config := &ledgerConfig{
+		now: time.Now,
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Ledger{
+		store:   store,
+		credits: credits,
+		config:  config,
+	}, nil
+}
+
+// Grant records the credits of a consumable purchase: the credits of its SKU times its quantity.
+// It returns the grant entry, and whether it was recorded by this call.
+func (l *Ledger) Grant(purchase iaphub.Purchase) (Entry, bool, error) {
+	if err := l.check(purchase); err != nil {
+		return Entry{}, false, err
+	}
+
+	quantity := purchase.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+	entry := Entry{
+		Id:         purchase.Id + ":" + string(EntryGrant),
+		Type:       EntryGrant,
+		UserId:     purchase.CustomerId(),
+		PurchaseId: purchase.Id,
+		Sku:        purchase.ProductSku,
+		Quantity:   quantity,
+		Credits:    l.credits[purchase.ProductSku] * int64(quantity),
+		Date:       l.dateOr(purchase.PurchaseDate),
+	}
+
+	return l.add(entry)
+}
+
+// Reverse takes back the credits granted for a refunded purchase, granting them first if the refund comes first.
+// It returns the reversal entry, and whether it was recorded by this call.
+func (l *Ledger) Reverse(purchase iaphub.Purchase) (Entry, bool, error) {
+	grant, _, err := l.Grant(purchase)
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	entry := grant
+	entry.Id = purchase.Id + ":" + string(EntryReversal)
+	entry.Type = EntryReversal
+	entry.Credits = -grant.Credits
+	entry.Date = l.dateOr(purchase.RefundDate)
+
+	return l.add(entry)
+}
+
+// Sync records the entries of a purchase that are missing: its grant, and its reversal if refunded.
+// Purchases of other product types and consumables without credits are ignored.
+// It returns the entries recorded by this call.
+func (l *Ledger) Sync(purchase iaphub.Purchase) ([]Entry, error) {
+	if _, found := l.credits[purchase.ProductSku]; !found || purchase.ProductType != iaphub.ProductTypeConsumable {
+		return nil, nil
+	}
+
+	var recorded []Entry
+	entry, added, err := l.Grant(purchase)
+	if err != nil {
+		return recorded, err
+	} else if added {
+		recorded = append(recorded, entry)
+	}
+	if purchase.IsRefunded {
+		entry, added, err = l.Reverse(purchase)
+		if err != nil {
+			return recorded, err
+		} else if added {
+			recorded = append(recorded, entry)
+		}
+	}
+
+	return recorded, nil
+}
+
+// SyncAll syncs the purchases of the history, and returns the number of entries recorded.
+func (l *Ledger) SyncAll(client iaphub.PurchaseIterator, request iaphub.GetPurchasesRequest) (int, error) {
+	count := 0
+	err := client.EachPurchase(request, func(purchase iaphub.Purchase) error {
+		recorded, err := l.Sync(purchase)
+		count += len(recorded)
+		return err
+	})
+
+	return count, err
+}
+
+// HandleEvent is a webhook.HandlerFunc syncing the purchases of purchase and refund events.
+func (l *Ledger) HandleEvent(ctx context.Context, event webhook.Event) error {
+	if event.Data.Purchase == nil || (event.Type != webhook.EventTypePurchase && event.Type != webhook.EventTypeRefund) {
+		return nil
+	}
+	_, err := l.Sync(*event.Data.Purchase)
+
+	return err
+}
+
+// Balance returns the credits of the user
+func (l *Ledger) Balance(userId string) (int64, error) {
+	entries, err := l.store.Entries(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	var balance int64
+	for _, entry := range entries {
+		balance += entry.Credits
+	}
+
+	return balance, nil
+}
+
+// History returns the entries of the user, in the order they were recorded
+func (l *Ledger) History(userId string) ([]Entry, error) {
+	return l.store.Entries(userId)
+}
+
+func (l *Ledger) check(purchase iaphub.Purchase) error {
+	if purchase.ProductType != iaphub.ProductTypeConsumable {
+		return fmt.Errorf("purchase %s is not a consumable", purchase.Id)
+	} else if purchase.Id == "" {
+		return errors.New("purchase id is not specified")
+	} else if purchase.CustomerId() == "" {
+		return fmt.Errorf("purchase %s has no user", purchase.Id)
+	} else if _, found := l.credits[purchase.ProductSku]; !found {
+		return fmt.Errorf("no credits for sku %s", purchase.ProductSku)
+	}
+
+	return nil
+}
+
+// add records the entry, or returns the entry already recorded with its id
+func (l *Ledger) add(entry Entry) (Entry, bool, error) {
+	err := l.store.Add(entry)
+	if err == nil {
+		return entry, true, nil
+	} else if !errors.Is(err, ErrEntryExists) {
+		return Entry{}, false, err
+	}
+
+	existing, found, err := l.store.Get(entry.Id)
+	if err != nil {
+		return Entry{}, false, err
+	} else if !found {
+		return Entry{}, false, fmt.Errorf("entry %s not found", entry.Id)
+	}
+
+	return existing, false, nil
+}
+
+func (l *Ledger) dateOr(date time.Time) time.Time {
+	if date.IsZero() {
+		return l.config.now()
+	}
+
+	return date
+}
+
+// UseClock sets the clock dating the entries of purchases without purchase or refund date
+func UseClock(now func() time.Time) Option {
+	return func(c *ledgerConfig) error {
+		if now == nil {
+			return errors.New("clock is not specified")
+		}
+		c.now = now
+
+		return nil
+	}
+}
+
+type ledgerConfig struct {
+	now func() time.Time
+}
+
+type Option func(*ledgerConfig) error
@@ -0,0 +1,206 @@
+package ledger_test
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/ledger"
+	"github.com/n10ty/iaphub-go/webhook"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2019, 10, 5, 0, 0, 0, 0, time.UTC)
+
+type purchaseIterator func(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error
+
+func (f purchaseIterator) EachPurchase(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error {
+	return f(request, fn)
+}
+
+func newLedger(t *testing.T) *ledger.Ledger {
+	l, err := ledger.NewLedger(ledger.NewMemoryStore(), map[string]int64{"coins_100": 100, "coins_500": 500}, ledger.UseClock(func() time.Time {
+		return now
+	}))
+	if err != nil {
+		t.Fatalf("NewLedger failed: %s", err)
+	}
+	return l
+}
+
+func consumable(id, sku string, quantity int) iaphub.Purchase {
+	return iaphub.Purchase{
+		Id:           id,
+		UserId:       "42",
+		ProductSku:   sku,
+		ProductType:  iaphub.ProductTypeConsumable,
+		Quantity:     quantity,
+		PurchaseDate: time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestGrantReverse(t *testing.T) {
+	l := newLedger(t)
+
+	purchase := consumable("p1", "coins_100", 3)
+	entry, added, err := l.Grant(purchase)
+	if err != nil {
+		t.Fatalf("Grant failed: %s", err)
+	}
+	expected := ledger.Entry{
+		Id:         "p1:grant",
+		Type:       ledger.EntryGrant,
+		UserId:     "42",
+		PurchaseId: "p1",
+		Sku:        "coins_100",
+		Quantity:   3,
+		Credits:    300,
+		Date:       purchase.PurchaseDate,
+	}
+	if !added || !reflect.DeepEqual(entry, expected) {
+		t.Errorf("wrong grant; expected: %+v, got: %+v (added: %t)", expected, entry, added)
+	}
+
+	if entry, added, _ := l.Grant(purchase); added || !reflect.DeepEqual(entry, expected) {
+		t.Errorf("expected grant to be recorded once, got: %+v (added: %t)", entry, added)
+	}
+	if _, _, err := l.Grant(consumable("p2", "unknown", 1)); err == nil {
+		t.Error("expected error for unknown sku")
+	}
+	subscription := consumable("p3", "coins_100", 1)
+	subscription.ProductType = iaphub.ProductTypeRenewableSubscription
+	if _, _, err := l.Grant(subscription); err == nil {
+		t.Error("expected error for subscription")
+	}
+
+	purchase.IsRefunded = true
+	reversal, added, err := l.Reverse(purchase)
+	if err != nil {
+		t.Fatalf("Reverse failed: %s", err)
+	}
+	if !added || reversal.Id != "p1:reversal" || reversal.Type != ledger.EntryReversal || reversal.Credits != -300 || !reversal.Date.Equal(now) {
+		t.Errorf("wrong reversal: %+v (added: %t)", reversal, added)
+	}
+	if _, added, _ := l.Reverse(purchase); added {
+		t.Error("expected reversal to be recorded once")
+	}
+
+	if balance, _ := l.Balance("42"); balance != 0 {
+		t.Errorf("wrong balance; expected: 0, got: %d", balance)
+	}
+}
+
+func TestSync(t *testing.T) {
+	l := newLedger(t)
+
+	refunded := consumable("p2", "coins_500", 0)
+	refunded.IsRefunded = true
+	refunded.RefundDate = time.Date(2019, 10, 2, 0, 0, 0, 0, time.UTC)
+	subscription := consumable("p3", "monthly", 1)
+	subscription.ProductType = iaphub.ProductTypeRenewableSubscription
+	purchases := []iaphub.Purchase{consumable("p1", "coins_100", 2), refunded, subscription}
+
+	client := purchaseIterator(func(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error {
+		for _, purchase := range purchases {
+			if err := fn(purchase); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	count, err := l.SyncAll(client, iaphub.GetPurchasesRequest{})
+	if err != nil {
+		t.Fatalf("SyncAll failed: %s", err)
+	}
+	if count != 3 {
+		t.Errorf("wrong count; expected: 3, got: %d", count)
+	}
+	if count, _ := l.SyncAll(client, iaphub.GetPurchasesRequest{}); count != 0 {
+		t.Errorf("expected nothing recorded on second sync, got: %d", count)
+	}
+
+	history, _ := l.History("42")
+	var ids []string
+	for _, entry := range history {
+		ids = append(ids, entry.Id)
+	}
+	expectedIds := []string{"p1:grant", "p2:grant", "p2:reversal"}
+	if !reflect.DeepEqual(ids, expectedIds) {
+		t.Errorf("wrong history; expected: %v, got: %v", expectedIds, ids)
+	}
+	if balance, _ := l.Balance("42"); balance != 200 {
+		t.Errorf("wrong balance; expected: 200, got: %d", balance)
+	}
+
+	// Consumables without credits are ignored
+	purchases = []iaphub.Purchase{consumable("p4", "other_consumable", 1), consumable("p5", "coins_100", 1)}
+	if count, err := l.SyncAll(client, iaphub.GetPurchasesRequest{}); err != nil || count != 1 {
+		t.Errorf("wrong sync; expected: 1, got: %d (%v)", count, err)
+	}
+
+	purchases = []iaphub.Purchase{{Id: "p6", ProductSku: "coins_100", ProductType: iaphub.ProductTypeConsumable}}
+	if _, err := l.SyncAll(client, iaphub.GetPurchasesRequest{}); err == nil || err.Error() != "purchase p6 has no user" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	l := newLedger(t)
+
+	purchase := consumable("p1", "coins_100", 1)
+	event := webhook.Event{Type: webhook.EventTypePurchase, Data: webhook.EventData{Purchase: &purchase}}
+	for i := 0; i < 2; i++ {
+		if err := l.HandleEvent(context.Background(), event); err != nil {
+			t.Fatalf("HandleEvent failed: %s", err)
+		}
+	}
+	if balance, _ := l.Balance("42"); balance != 100 {
+		t.Errorf("wrong balance; expected: 100, got: %d", balance)
+	}
+
+	refunded := purchase
+	refunded.IsRefunded = true
+	refund := webhook.Event{Type: webhook.EventTypeRefund, Data: webhook.EventData{Purchase: &refunded}}
+	if err := l.HandleEvent(context.Background(), refund); err != nil {
+		t.Fatalf("HandleEvent failed: %s", err)
+	}
+	if balance, _ := l.Balance("42"); balance != 0 {
+		t.Errorf("wrong balance; expected: 0, got: %d", balance)
+	}
+
+	other := consumable("p2", "other_consumable", 1)
+	if err := l.HandleEvent(context.Background(), webhook.Event{Type: webhook.EventTypePurchase, Data: webhook.EventData{Purchase: &other}}); err != nil {
+		t.Errorf("expected consumables without credits to be ignored, got: %s", err)
+	}
+
+	renewal := webhook.Event{Type: webhook.EventTypeSubscriptionRenewal, Data: webhook.EventData{Purchase: &purchase}}
+	if err := l.HandleEvent(context.Background(), renewal); err != nil {
+		t.Errorf("expected other events to be ignored, got: %s", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := ledger.NewMemoryStore()
+	if err := store.Add(ledger.Entry{Id: "p1:grant", UserId: "42"}); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	if err := store.Add(ledger.Entry{Id: "p1:grant", UserId: "42"}); !errors.Is(err, ledger.ErrEntryExists) {
+		t.Errorf("wrong error; expected: %s, got: %v", ledger.ErrEntryExists, err)
+	}
+	if entries, _ := store.Entries("43"); len(entries) != 0 {
+		t.Errorf("expected no entries, got: %+v", entries)
+	}
+}
+
+func TestNewLedger(t *testing.T) {
+	if _, err := ledger.NewLedger(nil, map[string]int64{"coins": 1}); err == nil {
+		t.Error("expected error without store")
+	}
+	if _, err := ledger.NewLedger(ledger.NewMemoryStore(), nil); err == nil {
+		t.Error("expected error without credits")
+	}
+	if _, err := ledger.NewLedger(ledger.NewMemoryStore(), map[string]int64{"coins": 0}); err == nil {
+		t.Error("expected error for credits not positive")
+	}
+}
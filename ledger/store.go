@@ -0,0 +1,84 @@
+package ledger
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrEntryExists is returned by Store.Add when an entry with the same id was already recorded
+var ErrEntryExists = errors.New("entry already exists")
+
+type EntryType string
+
+const (
+	EntryGrant    EntryType = "grant"
+	EntryReversal EntryType = "reversal"
+)
+
+// Entry is a change of the credit balance of a user, caused by a consumable purchase
+type Entry struct {
+	// Unique per purchase and entry type, e.g. "<purchaseId>:grant"
+	Id         string    `json:"id"`
+	Type       EntryType `json:"type"`
+	UserId     string    `json:"userId"`
+	PurchaseId string    `json:"purchaseId"`
+	Sku        string    `json:"sku"`
+	Quantity   int       `json:"quantity"`
+	// Credits added to the balance, negative for reversals
+	Credits int64     `json:"credits"`
+	Date    time.Time `json:"date"`
+}
+
+// Store keeps the entries of the ledger
+type Store interface {
+	// Add records the entry, it returns ErrEntryExists if an entry with the same id was already recorded
+	Add(entry Entry) error
+	Get(id string) (Entry, bool, error)
+	// Entries returns the entries of the user, in the order they were added
+	Entries(userId string) ([]Entry, error)
+}
+
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+	users   map[string][]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]Entry{},
+		users:   map[string][]string{},
+	}
+}
+
+func (s *MemoryStore) Add(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[entry.Id]; ok {
+		return ErrEntryExists
+	}
+	s.entries[entry.Id] = entry
+	s.users[entry.UserId] = append(s.users[entry.UserId], entry.Id)
+
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Entry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[id]
+
+	return entry, ok, nil
+}
+
+func (s *MemoryStore) Entries(userId string) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]Entry, 0, len(s.users[userId]))
+	for _, id := range s.users[userId] {
+		entries = append(entries, s.entries[id])
+	}
+
+	return entries, nil
+}
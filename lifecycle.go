@@ -0,0 +1,107 @@
+package iaphub
+
+import "time"
+
+// Type of a subscription lifecycle event
+type LifecycleEventType string
+
+const (
+	LifecycleStarted        LifecycleEventType = "started"
+	LifecycleTrialStarted   LifecycleEventType = "trial_started"
+	LifecycleTrialConverted LifecycleEventType = "trial_converted"
+	LifecycleRenewed        LifecycleEventType = "renewed"
+	LifecycleEnteredGrace   LifecycleEventType = "entered_grace"
+	LifecycleEnteredRetry   LifecycleEventType = "entered_retry"
+	LifecycleRecovered      LifecycleEventType = "recovered"
+	LifecyclePaused         LifecycleEventType = "paused"
+	LifecycleResumed        LifecycleEventType = "resumed"
+	LifecycleCancelled      LifecycleEventType = "cancelled"
+	LifecycleExpired        LifecycleEventType = "expired"
+	LifecycleRefunded       LifecycleEventType = "refunded"
+	LifecycleReplaced       LifecycleEventType = "replaced"
+)
+
+// LifecycleEvent is a change of a subscription between two reads
+type LifecycleEvent struct {
+	Type LifecycleEventType
+	// Date of the change when the purchase tells it, zero otherwise
+	Date time.Time
+	// Purchase after the change
+	Purchase Purchase
+}
+
+// Diff returns the lifecycle events leading from the prev to the next read of a subscription, in this order:
+// start or new period (started, trial_started, renewed, trial_converted, replaced), state changes (entered_grace,
+// entered_retry, recovered, paused, resumed, expired), then cancelled and refunded.
+// prev is the zero Purchase when the subscription was unknown. next can be a later period of the subscription.
+func Diff(prev, next Purchase) []LifecycleEvent {
+	var events []LifecycleEvent
+	add := func(eventType LifecycleEventType, date time.Time) {
+		events = append(events, LifecycleEvent{Type: eventType, Date: date, Purchase: next})
+	}
+
+	newPeriod := prev.Id != "" && prev.Id != next.Id
+	switch {
+	case prev.Id == "":
+		add(LifecycleStarted, next.PurchaseDate)
+		if next.SubscriptionPeriodType == SubscriptionPeriodTypeTrial {
+			add(LifecycleTrialStarted, next.PurchaseDate)
+		}
+	case newPeriod && (prev.ProductSku != next.ProductSku || prev.SubscriptionCancelReason == SubscriptionCancelReasonSubscriptionReplaced):
+		add(LifecycleReplaced, next.PurchaseDate)
+	case newPeriod:
+		add(LifecycleRenewed, next.PurchaseDate)
+		if next.IsTrialConversion || (prev.SubscriptionPeriodType == SubscriptionPeriodTypeTrial && next.SubscriptionPeriodType != SubscriptionPeriodTypeTrial) {
+			add(LifecycleTrialConverted, next.PurchaseDate)
+		}
+	case prev.SubscriptionCancelReason != SubscriptionCancelReasonSubscriptionReplaced && next.SubscriptionCancelReason == SubscriptionCancelReasonSubscriptionReplaced:
+		add(LifecycleReplaced, time.Time{})
+	}
+
+	prevState, nextState := stateOf(prev), stateOf(next)
+	if prevState != nextState && prev.Id != "" {
+		switch nextState {
+		case SubscriptionStateGracePeriod:
+			add(LifecycleEnteredGrace, time.Time{})
+		case SubscriptionStateRetryPeriod:
+			add(LifecycleEnteredRetry, time.Time{})
+		case SubscriptionStatePaused:
+			add(LifecyclePaused, next.ExpirationDate)
+		case SubscriptionStateExpired:
+			add(LifecycleExpired, next.ExpirationDate)
+		case SubscriptionStateActive:
+			switch prevState {
+			case SubscriptionStateGracePeriod, SubscriptionStateRetryPeriod:
+				add(LifecycleRecovered, time.Time{})
+			case SubscriptionStatePaused:
+				add(LifecycleResumed, time.Time{})
+			}
+		}
+	}
+
+	if prev.Id != "" && !newPeriod && prev.IsSubscriptionRenewable && !next.IsSubscriptionRenewable &&
+		next.SubscriptionCancelReason != SubscriptionCancelReasonSubscriptionReplaced {
+		add(LifecycleCancelled, time.Time{})
+	}
+	if next.IsRefunded && (newPeriod || !prev.IsRefunded) {
+		add(LifecycleRefunded, next.RefundDate)
+	}
+
+	return events
+}
+
+// stateOf returns the subscription state, derived from the flags when the state is not set
+func stateOf(purchase Purchase) SubscriptionState {
+	switch {
+	case purchase.SubscriptionState != "":
+		return purchase.SubscriptionState
+	case purchase.IsSubscriptionGracePeriod:
+		return SubscriptionStateGracePeriod
+	case purchase.IsSubscriptionRetryPeriod:
+		return SubscriptionStateRetryPeriod
+	case purchase.IsSubscriptionActive:
+		return SubscriptionStateActive
+	}
+
+	return ""
+}
@@ -0,0 +1,100 @@
+package iaphub_test
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	start := time.Date(2019, 10, 12, 17, 0, 0, 0, time.UTC)
+	trial := iaphub.Purchase{
+		Id:                      "p1",
+		ProductSku:              "monthly",
+		PurchaseDate:            start,
+		ExpirationDate:          start.AddDate(0, 0, 7),
+		IsSubscriptionRenewable: true,
+		SubscriptionState:       iaphub.SubscriptionStateActive,
+		SubscriptionPeriodType:  iaphub.SubscriptionPeriodTypeTrial,
+	}
+	active := iaphub.Purchase{
+		Id:                      "p2",
+		ProductSku:              "monthly",
+		PurchaseDate:            start.AddDate(0, 0, 7),
+		ExpirationDate:          start.AddDate(0, 1, 7),
+		LinkedPurchase:          "p1",
+		IsSubscriptionRenewable: true,
+		IsTrialConversion:       true,
+		SubscriptionState:       iaphub.SubscriptionStateActive,
+		SubscriptionPeriodType:  iaphub.SubscriptionPeriodTypeNormal,
+	}
+	with := func(p iaphub.Purchase, change func(p *iaphub.Purchase)) iaphub.Purchase {
+		change(&p)
+		return p
+	}
+	retry := with(active, func(p *iaphub.Purchase) { p.SubscriptionState = iaphub.SubscriptionStateRetryPeriod })
+	renewed := with(active, func(p *iaphub.Purchase) {
+		p.Id = "p3"
+		p.LinkedPurchase = "p2"
+		p.IsTrialConversion = false
+	})
+	refunded := with(active, func(p *iaphub.Purchase) {
+		p.IsRefunded = true
+		p.RefundDate = start.AddDate(0, 0, 10)
+		p.IsSubscriptionRenewable = false
+		p.SubscriptionState = iaphub.SubscriptionStateExpired
+		p.SubscriptionCancelReason = iaphub.SubscriptionCancelReasonRefunded
+	})
+
+	tests := []struct {
+		name     string
+		prev     iaphub.Purchase
+		next     iaphub.Purchase
+		expected []iaphub.LifecycleEventType
+	}{
+		{"trial started", iaphub.Purchase{}, trial, []iaphub.LifecycleEventType{iaphub.LifecycleStarted, iaphub.LifecycleTrialStarted}},
+		{"trial converted", trial, active, []iaphub.LifecycleEventType{iaphub.LifecycleRenewed, iaphub.LifecycleTrialConverted}},
+		{"no change", active, active, nil},
+		{"entered retry", active, retry, []iaphub.LifecycleEventType{iaphub.LifecycleEnteredRetry}},
+		{"entered grace", active, with(active, func(p *iaphub.Purchase) { p.SubscriptionState = iaphub.SubscriptionStateGracePeriod }),
+			[]iaphub.LifecycleEventType{iaphub.LifecycleEnteredGrace}},
+		{"recovered by renewal", retry, renewed, []iaphub.LifecycleEventType{iaphub.LifecycleRenewed, iaphub.LifecycleRecovered}},
+		{"paused", active, with(active, func(p *iaphub.Purchase) { p.SubscriptionState = iaphub.SubscriptionStatePaused }),
+			[]iaphub.LifecycleEventType{iaphub.LifecyclePaused}},
+		{"resumed", with(active, func(p *iaphub.Purchase) { p.SubscriptionState = iaphub.SubscriptionStatePaused }), active,
+			[]iaphub.LifecycleEventType{iaphub.LifecycleResumed}},
+		{"cancelled", active, with(active, func(p *iaphub.Purchase) {
+			p.IsSubscriptionRenewable = false
+			p.SubscriptionCancelReason = iaphub.SubscriptionCancelReasonCustomerCancelled
+		}), []iaphub.LifecycleEventType{iaphub.LifecycleCancelled}},
+		{"expired", with(active, func(p *iaphub.Purchase) { p.IsSubscriptionRenewable = false }),
+			with(active, func(p *iaphub.Purchase) {
+				p.IsSubscriptionRenewable = false
+				p.SubscriptionState = iaphub.SubscriptionStateExpired
+			}), []iaphub.LifecycleEventType{iaphub.LifecycleExpired}},
+		{"refunded", active, refunded, []iaphub.LifecycleEventType{iaphub.LifecycleExpired, iaphub.LifecycleCancelled, iaphub.LifecycleRefunded}},
+		{"replaced by another product", active, with(renewed, func(p *iaphub.Purchase) { p.ProductSku = "yearly" }),
+			[]iaphub.LifecycleEventType{iaphub.LifecycleReplaced}},
+		{"marked as replaced", active, with(active, func(p *iaphub.Purchase) {
+			p.IsSubscriptionRenewable = false
+			p.SubscriptionCancelReason = iaphub.SubscriptionCancelReasonSubscriptionReplaced
+		}), []iaphub.LifecycleEventType{iaphub.LifecycleReplaced}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var types []iaphub.LifecycleEventType
+			for _, event := range iaphub.Diff(tt.prev, tt.next) {
+				types = append(types, event.Type)
+			}
+			if !reflect.DeepEqual(types, tt.expected) {
+				t.Errorf("wrong events; expected: %v, got: %v", tt.expected, types)
+			}
+		})
+	}
+
+	events := iaphub.Diff(active, refunded)
+	if refund := events[len(events)-1]; !refund.Date.Equal(refunded.RefundDate) || refund.Purchase.Id != "p2" {
+		t.Errorf("wrong refund event: %#v", refund)
+	}
+}
@@ -0,0 +1,144 @@
+package risk
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/analytics"
+	"sort"
+)
+
+// Finding is a suspicious pattern found by a rule in the purchases of a user
+type Finding struct {
+	Rule   string
+	Weight float64
+	UserId string
+	// Purchases showing the pattern
+	PurchaseIds []string
+	// Human readable explanation, for the review of the account
+	Explanation string
+}
+
+// Rule looks for a suspicious pattern in the purchase history
+type Rule interface {
+	Name() string
+	Evaluate(purchases []iaphub.Purchase) []Finding
+}
+
+// Assessment is the risk score of a user or a purchase, the sum of the weights of its findings
+type Assessment struct {
+	Id       string
+	Score    float64
+	Findings []Finding
+}
+
+type Report struct {
+	// Users with findings, by decreasing score
+	Users []Assessment
+	// Purchases with findings, by decreasing score
+	Purchases []Assessment
+}
+
+// Score applies the rules to the purchases of the source, DefaultRules when none is given.
+func Score(source analytics.Source, rules ...Rule) (Report, error) {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+
+	var purchases []iaphub.Purchase
+	err := source(func(purchase iaphub.Purchase) error {
+		purchases = append(purchases, purchase)
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	users := map[string]*Assessment{}
+	byPurchase := map[string]*Assessment{}
+	add := func(assessments map[string]*Assessment, id string, finding Finding) {
+		assessment, found := assessments[id]
+		if !found {
+			assessment = &Assessment{Id: id}
+			assessments[id] = assessment
+		}
+		assessment.Score += finding.Weight
+		assessment.Findings = append(assessment.Findings, finding)
+	}
+	for _, rule := range rules {
+		for _, finding := range rule.Evaluate(purchases) {
+			if finding.Rule == "" {
+				finding.Rule = rule.Name()
+			}
+			add(users, finding.UserId, finding)
+			for _, purchaseId := range finding.PurchaseIds {
+				add(byPurchase, purchaseId, finding)
+			}
+		}
+	}
+
+	return Report{
+		Users:     sorted(users),
+		Purchases: sorted(byPurchase),
+	}, nil
+}
+
+// ReviewQueue returns the users whose score reaches the threshold, by decreasing score.
+func (r Report) ReviewQueue(threshold float64) []Assessment {
+	var queue []Assessment
+	for _, user := range r.Users {
+		if user.Score >= threshold {
+			queue = append(queue, user)
+		}
+	}
+
+	return queue
+}
+
+func sorted(assessments map[string]*Assessment) []Assessment {
+	list := make([]Assessment, 0, len(assessments))
+	for _, assessment := range assessments {
+		list = append(list, *assessment)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].Id < list[j].Id
+	})
+
+	return list
+}
+
+// byUser groups the purchases matching the predicate by user, in the order of the users' first match
+func byUser(purchases []iaphub.Purchase, match func(iaphub.Purchase) bool) ([]string, map[string][]iaphub.Purchase) {
+	var users []string
+	grouped := map[string][]iaphub.Purchase{}
+	for _, purchase := range purchases {
+		if !match(purchase) {
+			continue
+		}
+		user := purchase.CustomerId()
+		if _, found := grouped[user]; !found {
+			users = append(users, user)
+		}
+		grouped[user] = append(grouped[user], purchase)
+	}
+
+	return users, grouped
+}
+
+func purchaseIds(purchases []iaphub.Purchase) []string {
+	ids := make([]string, 0, len(purchases))
+	for _, purchase := range purchases {
+		ids = append(ids, purchase.Id)
+	}
+
+	return ids
+}
+
+func weightOr(weight float64, fallback float64) float64 {
+	if weight == 0 {
+		return fallback
+	}
+
+	return weight
+}
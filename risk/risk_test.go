@@ -0,0 +1,106 @@
+package risk_test
+
+import (
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/analytics"
+	"github.com/n10ty/iaphub-go/risk"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScore(t *testing.T) {
+	purchases := []iaphub.Purchase{
+		{Id: "p1", UserId: "fraud", IsRefunded: true, RefundReason: iaphub.RefundReasonChargeback},
+		{Id: "p2", UserId: "fraud", IsRefunded: true, RefundReason: iaphub.RefundReasonFriendlyFraud},
+		{Id: "p3", UserId: "fraud", IsRefunded: true, RefundReason: iaphub.RefundReasonRemorse},
+		{Id: "p4", UserId: "remorse", IsRefunded: true, RefundReason: iaphub.RefundReasonChargeback},
+		{Id: "p5", UserId: "a", Receipt: "r1", UserIds: []string{"b", "c"}},
+		{Id: "p6", UserId: "d", Receipt: "r1"},
+		{Id: "p7", UserId: "e", Receipt: "r2", UserIds: []string{"f"}},
+		{Id: "p8", UserId: "family", IsFamilyShare: true},
+		{Id: "p9", UserId: "family", IsFamilyShare: true},
+		{Id: "p10", UserId: "family", IsFamilyShare: true},
+		{Id: "p11", UserId: "family"},
+		{Id: "p12", UserId: "tester", IsSandbox: true},
+		{
+			Id: "p13", UserId: "fraud", ProductType: iaphub.ProductTypeConsumable, IsRefunded: true,
+			PurchaseDate: date("2019-10-01 10:00"), RefundDate: date("2019-10-02 09:00"),
+		},
+		{
+			Id: "p14", UserId: "patient", ProductType: iaphub.ProductTypeConsumable, IsRefunded: true,
+			PurchaseDate: date("2019-10-01 10:00"), RefundDate: date("2019-10-10 09:00"),
+		},
+	}
+
+	report, err := risk.Score(analytics.FromPurchases(purchases))
+	if err != nil {
+		t.Fatalf("Score failed: %s", err)
+	}
+
+	var users []string
+	scores := map[string]float64{}
+	for _, user := range report.Users {
+		users = append(users, user.Id)
+		scores[user.Id] = user.Score
+	}
+	expectedUsers := []string{"fraud", "a", "b", "c", "d", "tester", "family"}
+	if !reflect.DeepEqual(users, expectedUsers) {
+		t.Errorf("wrong users; expected: %v, got: %v", expectedUsers, users)
+	}
+	if scores["fraud"] != 5 || scores["a"] != 2 || scores["family"] != 1 {
+		t.Errorf("wrong scores: %v", scores)
+	}
+
+	fraud := report.Users[0].Findings
+	expectedFindings := []risk.Finding{
+		{Rule: "fraud_refunds", Weight: 3, UserId: "fraud", PurchaseIds: []string{"p1", "p2"}, Explanation: "2 refunds for chargeback or friendly fraud"},
+		{Rule: "consume_then_refund", Weight: 2, UserId: "fraud", PurchaseIds: []string{"p13"}, Explanation: "1 consumables refunded within 48h0m0s of their purchase"},
+	}
+	if !reflect.DeepEqual(fraud, expectedFindings) {
+		t.Errorf("wrong findings; expected:\n%+v\ngot:\n%+v\n", expectedFindings, fraud)
+	}
+	if report.Users[1].Findings[0].Explanation != "receipt r1 shared by 4 users: a, b, c, d" {
+		t.Errorf("wrong explanation: %s", report.Users[1].Findings[0].Explanation)
+	}
+	if len(report.Users[2].Findings[0].PurchaseIds) != 0 {
+		t.Errorf("expected no purchase of the user sharing the receipt: %+v", report.Users[2].Findings[0])
+	}
+
+	if len(report.Purchases) != 9 || report.Purchases[0].Score != 3 {
+		t.Errorf("wrong purchases: %+v", report.Purchases)
+	}
+
+	queue := report.ReviewQueue(2)
+	if len(queue) != 6 || queue[0].Id != "fraud" {
+		t.Errorf("wrong review queue: %+v", queue)
+	}
+}
+
+func TestScoreRules(t *testing.T) {
+	purchases := []iaphub.Purchase{
+		{Id: "p1", User: "iaphub-user", IsSandbox: true},
+		{Id: "p2", UserId: "u", IsRefunded: true, RefundReason: iaphub.RefundReasonChargeback},
+	}
+
+	report, _ := risk.Score(analytics.FromPurchases(purchases), risk.SandboxPurchases{Environment: "staging"})
+	if len(report.Users) != 0 {
+		t.Errorf("expected no sandbox finding outside production: %+v", report.Users)
+	}
+
+	report, _ = risk.Score(analytics.FromPurchases(purchases),
+		risk.SandboxPurchases{Environment: iaphub.EnvProduction, Weight: 5},
+		risk.FraudRefunds{MinRefunds: 1},
+	)
+	if len(report.Users) != 2 || report.Users[0].Id != "iaphub-user" || report.Users[0].Score != 5 || report.Users[1].Score != 3 {
+		t.Errorf("wrong users: %+v", report.Users)
+	}
+}
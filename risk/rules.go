@@ -0,0 +1,255 @@
+package risk
+
+import (
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultRules returns every rule with its default settings, checking sandbox purchases against production.
+func DefaultRules() []Rule {
+	return []Rule{
+		FraudRefunds{},
+		SharedReceipt{},
+		FamilySharing{},
+		SandboxPurchases{Environment: iaphub.EnvProduction},
+		ConsumeThenRefund{},
+	}
+}
+
+// FraudRefunds flags users with repeated refunds for chargeback or friendly fraud
+type FraudRefunds struct {
+	// Minimum number of refunds (2 by default)
+	MinRefunds int
+	// Weight of the findings (3 by default)
+	Weight float64
+}
+
+func (r FraudRefunds) Name() string {
+	return "fraud_refunds"
+}
+
+func (r FraudRefunds) Evaluate(purchases []iaphub.Purchase) []Finding {
+	minRefunds := r.MinRefunds
+	if minRefunds <= 0 {
+		minRefunds = 2
+	}
+
+	users, refunds := byUser(purchases, func(p iaphub.Purchase) bool {
+		return p.IsRefunded && (p.RefundReason == iaphub.RefundReasonChargeback || p.RefundReason == iaphub.RefundReasonFriendlyFraud)
+	})
+	var findings []Finding
+	for _, user := range users {
+		if len(refunds[user]) < minRefunds {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:        r.Name(),
+			Weight:      weightOr(r.Weight, 3),
+			UserId:      user,
+			PurchaseIds: purchaseIds(refunds[user]),
+			Explanation: fmt.Sprintf("%d refunds for chargeback or friendly fraud", len(refunds[user])),
+		})
+	}
+
+	return findings
+}
+
+// SharedReceipt flags users of receipts shared by many users
+type SharedReceipt struct {
+	// Maximum number of users of a receipt (3 by default)
+	MaxUsers int
+	// Weight of the findings (2 by default)
+	Weight float64
+}
+
+func (r SharedReceipt) Name() string {
+	return "shared_receipt"
+}
+
+func (r SharedReceipt) Evaluate(purchases []iaphub.Purchase) []Finding {
+	maxUsers := r.MaxUsers
+	if maxUsers <= 0 {
+		maxUsers = 3
+	}
+
+	var receipts []string
+	users := map[string]map[string]bool{}
+	receiptPurchases := map[string][]iaphub.Purchase{}
+	for _, purchase := range purchases {
+		if purchase.Receipt == "" {
+			continue
+		}
+		if _, found := users[purchase.Receipt]; !found {
+			receipts = append(receipts, purchase.Receipt)
+			users[purchase.Receipt] = map[string]bool{}
+		}
+		for _, user := range append([]string{purchase.CustomerId()}, purchase.UserIds...) {
+			if user != "" {
+				users[purchase.Receipt][user] = true
+			}
+		}
+		receiptPurchases[purchase.Receipt] = append(receiptPurchases[purchase.Receipt], purchase)
+	}
+
+	var findings []Finding
+	for _, receipt := range receipts {
+		if len(users[receipt]) <= maxUsers {
+			continue
+		}
+		var sharing []string
+		for user := range users[receipt] {
+			sharing = append(sharing, user)
+		}
+		sort.Strings(sharing)
+		for _, user := range sharing {
+			var own []iaphub.Purchase
+			for _, purchase := range receiptPurchases[receipt] {
+				if purchase.CustomerId() == user {
+					own = append(own, purchase)
+				}
+			}
+			findings = append(findings, Finding{
+				Rule:        r.Name(),
+				Weight:      weightOr(r.Weight, 2),
+				UserId:      user,
+				PurchaseIds: purchaseIds(own),
+				Explanation: fmt.Sprintf("receipt %s shared by %d users: %s", receipt, len(sharing), strings.Join(sharing, ", ")),
+			})
+		}
+	}
+
+	return findings
+}
+
+// FamilySharing flags users with many purchases obtained through family sharing
+type FamilySharing struct {
+	// Minimum number of family shared purchases (3 by default)
+	MinPurchases int
+	// Minimum share of family shared purchases among the purchases of the user (0.5 by default)
+	MinRatio float64
+	// Weight of the findings (1 by default)
+	Weight float64
+}
+
+func (r FamilySharing) Name() string {
+	return "family_sharing"
+}
+
+func (r FamilySharing) Evaluate(purchases []iaphub.Purchase) []Finding {
+	minPurchases := r.MinPurchases
+	if minPurchases <= 0 {
+		minPurchases = 3
+	}
+	minRatio := r.MinRatio
+	if minRatio <= 0 {
+		minRatio = 0.5
+	}
+
+	users, all := byUser(purchases, func(p iaphub.Purchase) bool {
+		return true
+	})
+	var findings []Finding
+	for _, user := range users {
+		var shared []iaphub.Purchase
+		for _, purchase := range all[user] {
+			if purchase.IsFamilyShare {
+				shared = append(shared, purchase)
+			}
+		}
+		ratio := float64(len(shared)) / float64(len(all[user]))
+		if len(shared) < minPurchases || ratio < minRatio {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:        r.Name(),
+			Weight:      weightOr(r.Weight, 1),
+			UserId:      user,
+			PurchaseIds: purchaseIds(shared),
+			Explanation: fmt.Sprintf("%d of %d purchases obtained through family sharing", len(shared), len(all[user])),
+		})
+	}
+
+	return findings
+}
+
+// SandboxPurchases flags sandbox purchases in the history of a production environment
+type SandboxPurchases struct {
+	// Environment of the history, the rule only applies to production
+	Environment iaphub.Env
+	// Weight of the findings (2 by default)
+	Weight float64
+}
+
+func (r SandboxPurchases) Name() string {
+	return "sandbox_in_production"
+}
+
+func (r SandboxPurchases) Evaluate(purchases []iaphub.Purchase) []Finding {
+	if r.Environment != iaphub.EnvProduction {
+		return nil
+	}
+
+	users, sandbox := byUser(purchases, func(p iaphub.Purchase) bool {
+		return p.IsSandbox
+	})
+	var findings []Finding
+	for _, user := range users {
+		findings = append(findings, Finding{
+			Rule:        r.Name(),
+			Weight:      weightOr(r.Weight, 2),
+			UserId:      user,
+			PurchaseIds: purchaseIds(sandbox[user]),
+			Explanation: fmt.Sprintf("%d sandbox purchases in production", len(sandbox[user])),
+		})
+	}
+
+	return findings
+}
+
+// ConsumeThenRefund flags users refunding consumables shortly after buying them, once likely consumed
+type ConsumeThenRefund struct {
+	// Maximum time between the purchase and the refund (48 hours by default)
+	Within time.Duration
+	// Minimum number of such refunds (1 by default)
+	MinRefunds int
+	// Weight of the findings (2 by default)
+	Weight float64
+}
+
+func (r ConsumeThenRefund) Name() string {
+	return "consume_then_refund"
+}
+
+func (r ConsumeThenRefund) Evaluate(purchases []iaphub.Purchase) []Finding {
+	within := r.Within
+	if within <= 0 {
+		within = 48 * time.Hour
+	}
+	minRefunds := r.MinRefunds
+	if minRefunds <= 0 {
+		minRefunds = 1
+	}
+
+	users, refunds := byUser(purchases, func(p iaphub.Purchase) bool {
+		return p.ProductType == iaphub.ProductTypeConsumable && p.IsRefunded && !p.RefundDate.IsZero() &&
+			p.RefundDate.Sub(p.PurchaseDate) <= within
+	})
+	var findings []Finding
+	for _, user := range users {
+		if len(refunds[user]) < minRefunds {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:        r.Name(),
+			Weight:      weightOr(r.Weight, 2),
+			UserId:      user,
+			PurchaseIds: purchaseIds(refunds[user]),
+			Explanation: fmt.Sprintf("%d consumables refunded within %s of their purchase", len(refunds[user]), within),
+		})
+	}
+
+	return findings
+}
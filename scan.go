@@ -0,0 +1,192 @@
+package iaphub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const maxPurchasesLimit = 100
+
+type ScanPurchasesRequest struct {
+	GetPurchasesRequest
+	// Number of time slices the FromDate/ToDate window is split into
+	Slices int
+	// Maximum number of slices fetched concurrently
+	Workers int
+}
+
+// PurchaseIterator iterates over the purchase history, it is implemented by Client
+type PurchaseIterator interface {
+	EachPurchase(request GetPurchasesRequest, fn func(Purchase) error) error
+}
+
+// EachPurchase calls fn for every purchase matching the request, following pages until the last one.
+// Iteration stops at the first error returned by fn.
+func (c *Client) EachPurchase(request GetPurchasesRequest, fn func(Purchase) error) error {
+	if request.Page == 0 {
+		request.Page = 1
+	}
+	if request.Limit == 0 {
+		request.Limit = maxPurchasesLimit
+	}
+
+	for {
+		purchaseList, err := c.GetPurchases(request)
+		if err != nil {
+			return err
+		}
+		for _, purchase := range purchaseList.List {
+			if err := fn(purchase); err != nil {
+				return err
+			}
+		}
+		if !purchaseList.HasNextPage || len(purchaseList.List) == 0 {
+			return nil
+		}
+		request.Page++
+	}
+}
+
+// ScanPurchases splits the FromDate/ToDate window into time slices, fetches them concurrently and calls fn
+// for every purchase in the requested order. A purchase is only taken from the slice its PurchaseDate
+// belongs to, so purchases returned twice around slice boundaries are emitted once.
+// The Page field of the request is ignored.
+func (c *Client) ScanPurchases(request ScanPurchasesRequest, fn func(Purchase) error) error {
+	if request.FromDate.IsZero() || request.ToDate.IsZero() {
+		return fmt.Errorf("required parameter \"fromDate\" or \"toDate\" is missing")
+	} else if request.ToDate.Before(request.FromDate) {
+		return fmt.Errorf("parameter \"toDate\" is before \"fromDate\"")
+	}
+	if request.Order == "" {
+		request.Order = Ask
+	}
+	if request.Slices <= 0 {
+		request.Slices = 1
+	}
+	if request.Workers <= 0 {
+		request.Workers = 1
+	}
+
+	windows := splitWindow(request.FromDate, request.ToDate, request.Slices)
+	if request.Order == Desc {
+		for i, j := 0, len(windows)-1; i < j; i, j = i+1, j-1 {
+			windows[i], windows[j] = windows[j], windows[i]
+		}
+	}
+
+	type sliceResult struct {
+		purchases []Purchase
+		err       error
+	}
+
+	results := make([]chan sliceResult, len(windows))
+	for i := range results {
+		results[i] = make(chan sliceResult, 1)
+	}
+
+	// A worker slot is released only once the slice has been emitted,
+	// so at most Workers slices are held in memory at any time.
+	slots := make(chan struct{}, request.Workers)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, w := range windows {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+
+			wg.Add(1)
+			go func(i int, w window) {
+				defer wg.Done()
+				purchases, err := c.scanWindow(request.GetPurchasesRequest, w)
+				results[i] <- sliceResult{purchases: purchases, err: err}
+			}(i, w)
+		}
+	}()
+
+	for i := range windows {
+		result := <-results[i]
+		if result.err != nil {
+			return result.err
+		}
+		for _, purchase := range result.purchases {
+			if err := fn(purchase); err != nil {
+				return err
+			}
+		}
+		<-slots
+	}
+
+	return nil
+}
+
+func (c *Client) scanWindow(request GetPurchasesRequest, w window) ([]Purchase, error) {
+	// The API only accepts second precision dates: the request covers the window, which then filters the purchases
+	request.Page = 0
+	request.FromDate = w.from.Truncate(time.Second)
+	request.ToDate = w.to.Truncate(time.Second)
+	if request.ToDate.Before(w.to) {
+		request.ToDate = request.ToDate.Add(time.Second)
+	}
+
+	var purchases []Purchase
+	seen := map[string]bool{}
+	err := c.EachPurchase(request, func(purchase Purchase) error {
+		if !w.contains(purchase.PurchaseDate) || seen[purchase.Id] {
+			return nil
+		}
+		seen[purchase.Id] = true
+		purchases = append(purchases, purchase)
+
+		return nil
+	})
+
+	return purchases, err
+}
+
+type window struct {
+	from time.Time
+	to   time.Time
+	// The last window also includes purchases made exactly at its end
+	closed bool
+}
+
+func (w window) contains(t time.Time) bool {
+	if t.Before(w.from) {
+		return false
+	}
+	if w.closed {
+		return !t.After(w.to)
+	}
+
+	return t.Before(w.to)
+}
+
+// splitWindow splits [from, to] into at most n consecutive windows with inner boundaries on whole seconds,
+// as the API only accepts second precision dates. The first and last windows keep the exact from and to.
+func splitWindow(from time.Time, to time.Time, n int) []window {
+	step := (to.Sub(from.Truncate(time.Second)) / time.Duration(n)).Truncate(time.Second)
+	if step < time.Second {
+		step = time.Second
+	}
+
+	var windows []window
+	for start := from; ; {
+		end := start.Truncate(time.Second).Add(step)
+		if !end.Before(to) || len(windows) == n-1 {
+			return append(windows, window{from: start, to: to, closed: true})
+		}
+		windows = append(windows, window{from: start, to: end})
+		start = end
+	}
+}
@@ -0,0 +1,263 @@
+package iaphub_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_EachPurchase(t *testing.T) {
+	purchases := dummyPurchaseHistory()
+	httpClient := newClient(purchasesServer(purchases, nil))
+
+	client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient), iaphub.UseEnv(iaphub.Env(env)))
+
+	var ids []string
+	err := client.EachPurchase(iaphub.GetPurchasesRequest{Limit: 3, Order: iaphub.Ask}, func(p iaphub.Purchase) error {
+		ids = append(ids, p.Id)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("EachPurchase failed: %s", err)
+	}
+
+	expectedIds := purchaseIds(purchases)
+	if !reflect.DeepEqual(ids, expectedIds) {
+		t.Errorf("wrong purchases; expected:\n%v\ngot:\n%v\n", expectedIds, ids)
+	}
+}
+
+func TestClient_ScanPurchases(t *testing.T) {
+	purchases := dummyPurchaseHistory()
+	from := purchases[0].PurchaseDate
+	to := purchases[len(purchases)-1].PurchaseDate
+
+	tests := []struct {
+		name    string
+		order   iaphub.Order
+		slices  int
+		workers int
+	}{
+		{"single slice", iaphub.Ask, 1, 1},
+		{"ascending", iaphub.Ask, 5, 3},
+		{"descending", iaphub.Desc, 7, 4},
+		{"more slices than seconds", iaphub.Ask, 1000, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requested := 0
+			httpClient := newClient(purchasesServer(purchases, func(req *http.Request) {
+				mu.Lock()
+				requested++
+				mu.Unlock()
+			}))
+
+			client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient), iaphub.UseEnv(iaphub.Env(env)))
+
+			request := iaphub.ScanPurchasesRequest{
+				GetPurchasesRequest: iaphub.GetPurchasesRequest{
+					Limit:    2,
+					Order:    tt.order,
+					FromDate: from,
+					ToDate:   to,
+				},
+				Slices:  tt.slices,
+				Workers: tt.workers,
+			}
+
+			var ids []string
+			err := client.ScanPurchases(request, func(p iaphub.Purchase) error {
+				ids = append(ids, p.Id)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("ScanPurchases failed: %s", err)
+			}
+
+			expectedIds := purchaseIds(purchases)
+			if tt.order == iaphub.Desc {
+				sort.Sort(sort.Reverse(sort.StringSlice(expectedIds)))
+			}
+			if !reflect.DeepEqual(ids, expectedIds) {
+				t.Errorf("wrong purchases; expected:\n%v\ngot:\n%v\n", expectedIds, ids)
+			}
+			if requested == 0 {
+				t.Errorf("no request was sent")
+			}
+		})
+	}
+}
+
+func TestClient_ScanPurchasesSubSecondDates(t *testing.T) {
+	purchases := dummyPurchaseHistory()
+	httpClient := newClient(purchasesServer(purchases, nil))
+	client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient), iaphub.UseEnv(iaphub.Env(env)))
+
+	start := purchases[0].PurchaseDate
+	for _, slices := range []int{1, 3} {
+		var ids []string
+		err := client.ScanPurchases(iaphub.ScanPurchasesRequest{
+			GetPurchasesRequest: iaphub.GetPurchasesRequest{
+				FromDate: start.Add(500 * time.Millisecond),
+				ToDate:   start.Add(10*time.Second + 500*time.Millisecond),
+			},
+			Slices: slices,
+		}, func(p iaphub.Purchase) error {
+			ids = append(ids, p.Id)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("ScanPurchases failed: %s", err)
+		}
+
+		expectedIds := purchaseIds(purchases[2:6])
+		if !reflect.DeepEqual(ids, expectedIds) {
+			t.Errorf("wrong purchases with %d slices; expected:\n%v\ngot:\n%v\n", slices, expectedIds, ids)
+		}
+	}
+}
+
+func TestClient_ScanPurchasesStopsOnError(t *testing.T) {
+	purchases := dummyPurchaseHistory()
+	httpClient := newClient(purchasesServer(purchases, nil))
+	client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient), iaphub.UseEnv(iaphub.Env(env)))
+
+	stopErr := errors.New("stop")
+	count := 0
+	err := client.ScanPurchases(iaphub.ScanPurchasesRequest{
+		GetPurchasesRequest: iaphub.GetPurchasesRequest{
+			FromDate: purchases[0].PurchaseDate,
+			ToDate:   purchases[len(purchases)-1].PurchaseDate,
+		},
+		Slices:  4,
+		Workers: 2,
+	}, func(p iaphub.Purchase) error {
+		count++
+		if count == 3 {
+			return stopErr
+		}
+		return nil
+	})
+
+	if err != stopErr {
+		t.Errorf("wrong error; expected: %s, got: %v", stopErr, err)
+	}
+	if count != 3 {
+		t.Errorf("wrong number of purchases; expected: 3, got: %d", count)
+	}
+}
+
+func TestClient_ScanPurchasesMissingDates(t *testing.T) {
+	client, _ := iaphub.NewClient(apiKey1, appId1)
+
+	err := client.ScanPurchases(iaphub.ScanPurchasesRequest{}, func(p iaphub.Purchase) error {
+		return nil
+	})
+	if err == nil {
+		t.Errorf("expected error for missing dates")
+	}
+}
+
+// purchasesServer serves GET purchases from a fixture, applying the date filters inclusively on both ends
+// (with second precision) so that purchases on slice boundaries are returned twice.
+func purchasesServer(purchases []iaphub.Purchase, onRequest func(req *http.Request)) roundTripper {
+	return func(req *http.Request) (*http.Response, error) {
+		if onRequest != nil {
+			onRequest(req)
+		}
+		query := req.URL.Query()
+
+		var matching []iaphub.Purchase
+		for _, p := range purchases {
+			date := p.PurchaseDate.Truncate(time.Second)
+			if v := query.Get("fromDate"); v != "" {
+				from, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return nil, err
+				}
+				if date.Before(from) {
+					continue
+				}
+			}
+			if v := query.Get("toDate"); v != "" {
+				to, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return nil, err
+				}
+				if date.After(to) {
+					continue
+				}
+			}
+			matching = append(matching, p)
+		}
+		if query.Get("order") == string(iaphub.Desc) {
+			for i, j := 0, len(matching)-1; i < j; i, j = i+1, j-1 {
+				matching[i], matching[j] = matching[j], matching[i]
+			}
+		}
+
+		page, _ := strconv.Atoi(query.Get("page"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if page == 0 || limit == 0 {
+			return nil, fmt.Errorf("missing page or limit: %s", req.URL.String())
+		}
+		start := (page - 1) * limit
+		end := start + limit
+		if start > len(matching) {
+			start = len(matching)
+		}
+		if end > len(matching) {
+			end = len(matching)
+		}
+
+		body, _ := json.Marshal(iaphub.PurchaseList{
+			HasNextPage: end < len(matching),
+			List:        matching[start:end],
+		})
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewBuffer(body)),
+		}, nil
+	}
+}
+
+// dummyPurchaseHistory returns purchases sorted by date, some of them sharing the same second.
+func dummyPurchaseHistory() []iaphub.Purchase {
+	start, _ := time.Parse(time.RFC3339, "2019-10-12T17:00:00Z")
+	offsets := []time.Duration{
+		0, 250 * time.Millisecond, 1 * time.Second, 1500 * time.Millisecond, 3 * time.Second,
+		10 * time.Second, 10*time.Second + 999*time.Millisecond, 11 * time.Second, 30 * time.Second,
+		45 * time.Second, 59 * time.Second, 60 * time.Second,
+	}
+
+	var purchases []iaphub.Purchase
+	for i, offset := range offsets {
+		purchases = append(purchases, iaphub.Purchase{
+			Id:           fmt.Sprintf("purchase-%02d", i),
+			PurchaseDate: start.Add(offset),
+		})
+	}
+
+	return purchases
+}
+
+func purchaseIds(purchases []iaphub.Purchase) []string {
+	var ids []string
+	for _, p := range purchases {
+		ids = append(ids, p.Id)
+	}
+
+	return ids
+}
@@ -0,0 +1,198 @@
+package iaphub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Syncer incrementally reads purchases through GetPurchases, remembering its position in a CheckpointStore.
+//
+// Every run starts at the checkpoint minus the overlap window, so purchases that arrive late or change
+// shortly after being read are picked up again. Purchases inside the overlap window are only delivered
+// again when their content changed. Delivery is at least once: after a crash the purchases handled since
+// the last saved checkpoint are delivered again.
+type Syncer struct {
+	client *Client
+	store  CheckpointStore
+	config *syncConfig
+}
+
+type recentPurchase struct {
+	date        time.Time
+	fingerprint string
+}
+
+func NewSyncer(client *Client, store CheckpointStore, options ...SyncOption) (*Syncer, error) {
+	if client == nil {
+		return nil, errors.New("client is not specified")
+	} else if store == nil {
+		return nil, errors.New("checkpoint store is not specified")
+	}
+
+	config := &syncConfig{
+		overlap:            time.Hour,
+		checkpointInterval: maxPurchasesLimit,
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Syncer{
+		client: client,
+		store:  store,
+		config: config,
+	}, nil
+}
+
+// Sync calls fn for every new or changed purchase since the last checkpoint, oldest first.
+// The checkpoint only moves past a purchase once fn returned without error for it.
+func (s *Syncer) Sync(fn func(Purchase) error) error {
+	checkpoint, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+
+	request := GetPurchasesRequest{
+		Order:    Ask,
+		FromDate: s.config.startDate,
+		User:     s.config.user,
+		UserId:   s.config.userId,
+	}
+	if !checkpoint.IsZero() {
+		request.FromDate = checkpoint.PurchaseDate.Add(-s.config.overlap)
+	}
+
+	cursor := checkpoint
+	recent := map[string]recentPurchase{}
+	pending := 0
+
+	save := func() error {
+		windowStart := cursor.PurchaseDate.Add(-s.config.overlap)
+		cursor.Recent = map[string]string{}
+		for id, r := range recent {
+			if r.date.Before(windowStart) {
+				delete(recent, id)
+				continue
+			}
+			cursor.Recent[id] = r.fingerprint
+		}
+		pending = 0
+
+		return s.store.Save(cursor)
+	}
+
+	err = s.client.EachPurchase(request, func(purchase Purchase) error {
+		fingerprint, err := purchaseFingerprint(purchase)
+		if err != nil {
+			return err
+		}
+		if checkpoint.Recent[purchase.Id] == fingerprint {
+			recent[purchase.Id] = recentPurchase{date: purchase.PurchaseDate, fingerprint: fingerprint}
+			return nil
+		}
+
+		if err := fn(purchase); err != nil {
+			return err
+		}
+
+		recent[purchase.Id] = recentPurchase{date: purchase.PurchaseDate, fingerprint: fingerprint}
+		if isAfterCursor(purchase, cursor) {
+			cursor.PurchaseDate = purchase.PurchaseDate
+			cursor.PurchaseId = purchase.Id
+		}
+
+		pending++
+		if pending >= s.config.checkpointInterval {
+			return save()
+		}
+
+		return nil
+	})
+	if err != nil {
+		if pending > 0 {
+			if saveErr := save(); saveErr != nil {
+				return saveErr
+			}
+		}
+		return err
+	}
+
+	return save()
+}
+
+func isAfterCursor(purchase Purchase, cursor Checkpoint) bool {
+	if purchase.PurchaseDate.Equal(cursor.PurchaseDate) {
+		return purchase.Id > cursor.PurchaseId
+	}
+
+	return purchase.PurchaseDate.After(cursor.PurchaseDate)
+}
+
+func purchaseFingerprint(purchase Purchase) (string, error) {
+	data, err := json.Marshal(purchase)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// UseOverlap sets how far before the checkpoint each sync starts reading again (one hour by default).
+func UseOverlap(overlap time.Duration) SyncOption {
+	return func(c *syncConfig) error {
+		if overlap < 0 {
+			return errors.New("overlap is negative")
+		}
+		c.overlap = overlap
+
+		return nil
+	}
+}
+
+// UseStartDate sets the date the first sync starts from when no checkpoint was saved yet.
+func UseStartDate(startDate time.Time) SyncOption {
+	return func(c *syncConfig) error {
+		c.startDate = startDate
+
+		return nil
+	}
+}
+
+// UseCheckpointInterval sets after how many delivered purchases the checkpoint is saved during a sync.
+func UseCheckpointInterval(n int) SyncOption {
+	return func(c *syncConfig) error {
+		if n <= 0 {
+			return errors.New("checkpoint interval must be positive")
+		}
+		c.checkpointInterval = n
+
+		return nil
+	}
+}
+
+// UseUserFilter limits the sync to the purchases of a single user.
+func UseUserFilter(user string, userId string) SyncOption {
+	return func(c *syncConfig) error {
+		c.user = user
+		c.userId = userId
+
+		return nil
+	}
+}
+
+type syncConfig struct {
+	overlap            time.Duration
+	startDate          time.Time
+	checkpointInterval int
+	user               string
+	userId             string
+}
+
+type SyncOption func(*syncConfig) error
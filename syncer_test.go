@@ -0,0 +1,130 @@
+package iaphub_test
+
+import (
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSyncer_Sync(t *testing.T) {
+	history := dummyPurchaseHistory()
+	httpClient := newClient(func(req *http.Request) (*http.Response, error) {
+		return purchasesServer(history, nil)(req)
+	})
+	client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient), iaphub.UseEnv(iaphub.Env(env)))
+	store := iaphub.NewMemoryCheckpointStore()
+
+	syncer, err := iaphub.NewSyncer(client, store, iaphub.UseOverlap(20*time.Second), iaphub.UseCheckpointInterval(2))
+	if err != nil {
+		t.Fatalf("NewSyncer failed: %s", err)
+	}
+
+	ids := syncIds(t, syncer)
+	if !reflect.DeepEqual(ids, purchaseIds(history)) {
+		t.Errorf("wrong first sync; expected:\n%v\ngot:\n%v\n", purchaseIds(history), ids)
+	}
+
+	checkpoint, _ := store.Load()
+	last := history[len(history)-1]
+	if !checkpoint.PurchaseDate.Equal(last.PurchaseDate) || checkpoint.PurchaseId != last.Id {
+		t.Errorf("wrong checkpoint; expected: %s %s, got: %s %s", last.PurchaseDate, last.Id, checkpoint.PurchaseDate, checkpoint.PurchaseId)
+	}
+
+	if ids := syncIds(t, syncer); len(ids) != 0 {
+		t.Errorf("unchanged purchases delivered again: %v", ids)
+	}
+
+	// A refund inside the overlap window, a late purchase inside it, one outside it and a new purchase.
+	history[9].IsRefunded = true
+	late := iaphub.Purchase{Id: "late-inside", PurchaseDate: last.PurchaseDate.Add(-5 * time.Second)}
+	tooLate := iaphub.Purchase{Id: "late-outside", PurchaseDate: last.PurchaseDate.Add(-50 * time.Second)}
+	fresh := iaphub.Purchase{Id: "new", PurchaseDate: last.PurchaseDate.Add(time.Minute)}
+	history = append(history[:1], append([]iaphub.Purchase{tooLate}, history[1:]...)...)
+	history = append(history[:len(history)-2], late, history[len(history)-2], history[len(history)-1], fresh)
+
+	ids = syncIds(t, syncer)
+	expected := []string{history[10].Id, "late-inside", "new"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("wrong incremental sync; expected:\n%v\ngot:\n%v\n", expected, ids)
+	}
+}
+
+func TestSyncer_SyncResumesAfterFailure(t *testing.T) {
+	history := dummyPurchaseHistory()
+	httpClient := newClient(purchasesServer(history, nil))
+	client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient), iaphub.UseEnv(iaphub.Env(env)))
+	store := iaphub.NewMemoryCheckpointStore()
+	syncer, _ := iaphub.NewSyncer(client, store, iaphub.UseOverlap(0), iaphub.UseCheckpointInterval(100))
+
+	failure := errors.New("warehouse is down")
+	var ids []string
+	err := syncer.Sync(func(p iaphub.Purchase) error {
+		if len(ids) == 5 {
+			return failure
+		}
+		ids = append(ids, p.Id)
+		return nil
+	})
+	if err != failure {
+		t.Errorf("wrong error; expected: %s, got: %v", failure, err)
+	}
+
+	checkpoint, _ := store.Load()
+	if checkpoint.PurchaseId != history[4].Id {
+		t.Errorf("wrong checkpoint after failure; expected: %s, got: %s", history[4].Id, checkpoint.PurchaseId)
+	}
+
+	ids = append(ids, syncIds(t, syncer)...)
+	if !reflect.DeepEqual(ids, purchaseIds(history)) {
+		t.Errorf("wrong resumed sync; expected:\n%v\ngot:\n%v\n", purchaseIds(history), ids)
+	}
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	store, err := iaphub.NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore failed: %s", err)
+	}
+
+	checkpoint, err := store.Load()
+	if err != nil || !checkpoint.IsZero() {
+		t.Errorf("expected zero checkpoint, got: %#v, %v", checkpoint, err)
+	}
+
+	date, _ := time.Parse(time.RFC3339, "2019-10-12T17:34:33.256Z")
+	expected := iaphub.Checkpoint{
+		PurchaseDate: date,
+		PurchaseId:   purchaseId,
+		Recent:       map[string]string{purchaseId: "fingerprint"},
+	}
+	if err = store.Save(expected); err != nil {
+		t.Errorf("Save failed: %s", err)
+	}
+
+	reopened, _ := iaphub.NewFileCheckpointStore(path)
+	actual, err := reopened.Load()
+	if err != nil {
+		t.Errorf("Load failed: %s", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("wrong checkpoint; expected:\n%#v\ngot:\n%#v\n", expected, actual)
+	}
+}
+
+func syncIds(t *testing.T, syncer *iaphub.Syncer) []string {
+	var ids []string
+	err := syncer.Sync(func(p iaphub.Purchase) error {
+		ids = append(ids, p.Id)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Sync failed: %s", err)
+	}
+
+	return ids
+}
@@ -0,0 +1,196 @@
+package iaphub
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// How a period of a subscription started
+type PeriodKind string
+
+// Type of a subscription event that is not a period
+type TimelineEventType string
+
+const (
+	PeriodKindInitial     PeriodKind = "initial"
+	PeriodKindRenewal     PeriodKind = "renewal"
+	PeriodKindReplacement PeriodKind = "replacement"
+
+	TimelineEventRefund TimelineEventType = "refund"
+	TimelineEventPause  TimelineEventType = "pause"
+)
+
+// Timeline is the history of a subscription, from its original purchase to its latest period
+type Timeline struct {
+	OriginalPurchase string
+	// Periods in chronological order, one per purchase
+	Periods []TimelinePeriod
+	// Refunds and pauses in chronological order
+	Events []TimelineEvent
+}
+
+// TimelinePeriod is a period of a subscription, compared to the previous one
+type TimelinePeriod struct {
+	Purchase Purchase
+	Kind     PeriodKind
+	// SKU of the previous period, set when the product changed, e.g. for upgrades and downgrades
+	PreviousSku string
+	// Time without subscription between the end of the previous period and the start of this one
+	Gap time.Duration
+	// Time this period overlaps the previous one
+	Overlap time.Duration
+}
+
+// TimelineEvent is a refund or a pause of a period
+type TimelineEvent struct {
+	Type       TimelineEventType
+	Date       time.Time
+	PurchaseId string
+	// Date when a paused subscription resumes, zero for refunds
+	ResumeDate time.Time
+}
+
+// Timeline rebuilds the history of the subscription from its current state, the purchases sharing its
+// original purchase and the purchases they link to.
+func (c *Client) Timeline(originalPurchaseId string) (Timeline, error) {
+	if originalPurchaseId == "" {
+		return Timeline{}, errors.New("required parameter \"originalPurchaseId\" is missing")
+	}
+
+	subscription, err := c.GetSubscription(GetSubscriptionRequest{OriginalPurchaseId: originalPurchaseId})
+	if err != nil {
+		return Timeline{}, err
+	}
+
+	purchases := map[string]Purchase{subscription.Id: subscription}
+	err = c.EachPurchase(GetPurchasesRequest{Order: Ask, OriginalPurchase: originalPurchaseId}, func(purchase Purchase) error {
+		purchases[purchase.Id] = purchase
+		return nil
+	})
+	if err != nil {
+		return Timeline{}, err
+	}
+
+	// Follow the links to the purchases the list missed, e.g. the original purchase itself
+	pending := []string{originalPurchaseId}
+	for _, purchase := range purchases {
+		pending = append(pending, purchase.LinkedPurchase, purchase.NextPurchase)
+	}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+		if _, found := purchases[id]; found || id == "" {
+			continue
+		}
+		purchase, err := c.GetPurchase(GetPurchaseRequest{PurchaseId: id})
+		if err != nil {
+			return Timeline{}, err
+		}
+		purchases[id] = purchase
+		pending = append(pending, purchase.LinkedPurchase, purchase.NextPurchase)
+	}
+
+	list := make([]Purchase, 0, len(purchases))
+	for _, purchase := range purchases {
+		list = append(list, purchase)
+	}
+	timeline := NewTimeline(list)
+	timeline.OriginalPurchase = originalPurchaseId
+
+	return timeline, nil
+}
+
+// NewTimeline builds the timeline of the purchases of a subscription.
+// The end of a period is its refund date when refunded before expiring, its expiration date otherwise.
+func NewTimeline(purchases []Purchase) Timeline {
+	sorted := append([]Purchase(nil), purchases...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].PurchaseDate.Equal(sorted[j].PurchaseDate) {
+			return sorted[i].Id < sorted[j].Id
+		}
+		return sorted[i].PurchaseDate.Before(sorted[j].PurchaseDate)
+	})
+
+	var timeline Timeline
+	for i, purchase := range sorted {
+		if timeline.OriginalPurchase == "" {
+			timeline.OriginalPurchase = purchase.OriginalPurchase
+		}
+
+		period := TimelinePeriod{Purchase: purchase, Kind: PeriodKindInitial}
+		if i > 0 {
+			previous := sorted[i-1]
+			period.Kind = PeriodKindRenewal
+			if previous.ProductSku != purchase.ProductSku || previous.SubscriptionCancelReason == SubscriptionCancelReasonSubscriptionReplaced {
+				period.Kind = PeriodKindReplacement
+			}
+			if previous.ProductSku != purchase.ProductSku {
+				period.PreviousSku = previous.ProductSku
+			}
+
+			end := periodEnd(previous)
+			if !end.IsZero() && purchase.PurchaseDate.After(end) {
+				period.Gap = purchase.PurchaseDate.Sub(end)
+			} else if end.After(purchase.PurchaseDate) {
+				period.Overlap = end.Sub(purchase.PurchaseDate)
+			}
+		}
+		timeline.Periods = append(timeline.Periods, period)
+
+		if purchase.IsRefunded && !purchase.RefundDate.IsZero() {
+			timeline.Events = append(timeline.Events, TimelineEvent{
+				Type:       TimelineEventRefund,
+				Date:       purchase.RefundDate,
+				PurchaseId: purchase.Id,
+			})
+		}
+		if purchase.SubscriptionState == SubscriptionStatePaused || !purchase.AutoResumeDate.IsZero() {
+			timeline.Events = append(timeline.Events, TimelineEvent{
+				Type:       TimelineEventPause,
+				Date:       purchase.ExpirationDate,
+				PurchaseId: purchase.Id,
+				ResumeDate: purchase.AutoResumeDate,
+			})
+		}
+	}
+
+	sort.SliceStable(timeline.Events, func(i, j int) bool {
+		return timeline.Events[i].Date.Before(timeline.Events[j].Date)
+	})
+
+	return timeline
+}
+
+// Gaps returns the periods starting after a time without subscription.
+func (t Timeline) Gaps() []TimelinePeriod {
+	var gaps []TimelinePeriod
+	for _, period := range t.Periods {
+		if period.Gap > 0 {
+			gaps = append(gaps, period)
+		}
+	}
+
+	return gaps
+}
+
+// Overlaps returns the periods starting before the end of the previous one.
+func (t Timeline) Overlaps() []TimelinePeriod {
+	var overlaps []TimelinePeriod
+	for _, period := range t.Periods {
+		if period.Overlap > 0 {
+			overlaps = append(overlaps, period)
+		}
+	}
+
+	return overlaps
+}
+
+func periodEnd(purchase Purchase) time.Time {
+	if purchase.IsRefunded && !purchase.RefundDate.IsZero() &&
+		(purchase.ExpirationDate.IsZero() || purchase.RefundDate.Before(purchase.ExpirationDate)) {
+		return purchase.RefundDate
+	}
+
+	return purchase.ExpirationDate
+}
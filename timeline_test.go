@@ -0,0 +1,69 @@
+package iaphub_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_Timeline(t *testing.T) {
+	start := time.Date(2019, 10, 12, 17, 0, 0, 0, time.UTC)
+	p1 := iaphub.Purchase{Id: "p1", ProductSku: "monthly", OriginalPurchase: "p1", PurchaseDate: start, ExpirationDate: start.AddDate(0, 1, 0), NextPurchase: "p2"}
+	p2 := iaphub.Purchase{Id: "p2", ProductSku: "monthly", OriginalPurchase: "p1", PurchaseDate: start.AddDate(0, 1, 0), ExpirationDate: start.AddDate(0, 2, 0),
+		LinkedPurchase: "p1", NextPurchase: "p3", SubscriptionCancelReason: iaphub.SubscriptionCancelReasonSubscriptionReplaced}
+	p3 := iaphub.Purchase{Id: "p3", ProductSku: "yearly", OriginalPurchase: "p1", PurchaseDate: start.AddDate(0, 1, 20), ExpirationDate: start.AddDate(1, 1, 20),
+		LinkedPurchase: "p2", IsRefunded: true, RefundDate: start.AddDate(0, 2, 5)}
+	p4 := iaphub.Purchase{Id: "p4", ProductSku: "yearly", OriginalPurchase: "p1", PurchaseDate: start.AddDate(0, 2, 15), ExpirationDate: start.AddDate(1, 2, 15),
+		SubscriptionState: iaphub.SubscriptionStatePaused, AutoResumeDate: start.AddDate(1, 3, 15)}
+
+	jsonBody := func(v interface{}) (*http.Response, error) {
+		body, _ := json.Marshal(v)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBuffer(body))}, nil
+	}
+	httpClient := newClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/v1/app/app-id-1/subscription/p1":
+			return jsonBody(p4)
+		case "/v1/app/app-id-1/purchase/p1":
+			return jsonBody(p1)
+		case "/v1/app/app-id-1/purchases":
+			if req.URL.Query().Get("originalPurchase") != "p1" {
+				return nil, fmt.Errorf("wrong filters: %s", req.URL.RawQuery)
+			}
+			return jsonBody(iaphub.PurchaseList{List: []iaphub.Purchase{p2, p3}})
+		}
+		return nil, fmt.Errorf("unexpected request: %s", req.URL.String())
+	})
+	client, _ := iaphub.NewClient(apiKey1, appId1, iaphub.UseClient(httpClient))
+
+	timeline, err := client.Timeline("p1")
+	if err != nil {
+		t.Fatalf("Timeline failed: %s", err)
+	}
+
+	expected := iaphub.Timeline{
+		OriginalPurchase: "p1",
+		Periods: []iaphub.TimelinePeriod{
+			{Purchase: p1, Kind: iaphub.PeriodKindInitial},
+			{Purchase: p2, Kind: iaphub.PeriodKindRenewal},
+			{Purchase: p3, Kind: iaphub.PeriodKindReplacement, PreviousSku: "monthly", Overlap: p2.ExpirationDate.Sub(p3.PurchaseDate)},
+			{Purchase: p4, Kind: iaphub.PeriodKindRenewal, Gap: p4.PurchaseDate.Sub(p3.RefundDate)},
+		},
+		Events: []iaphub.TimelineEvent{
+			{Type: iaphub.TimelineEventRefund, Date: p3.RefundDate, PurchaseId: "p3"},
+			{Type: iaphub.TimelineEventPause, Date: p4.ExpirationDate, PurchaseId: "p4", ResumeDate: p4.AutoResumeDate},
+		},
+	}
+	if !reflect.DeepEqual(timeline, expected) {
+		t.Errorf("wrong timeline; expected:\n%#v\ngot:\n%#v\n", expected, timeline)
+	}
+	if len(timeline.Gaps()) != 1 || len(timeline.Overlaps()) != 1 {
+		t.Errorf("wrong gaps or overlaps: %d, %d", len(timeline.Gaps()), len(timeline.Overlaps()))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 type GetUserRequest struct {
@@ -91,10 +92,22 @@ type User struct {
 }
 
 type Product struct {
-	Id       string `json:"id"`
-	Type     string `json:"type"`
-	Sku      string `json:"sku"`
-	Purchase string `json:"purchase"`
+	Id                        string                 `json:"id"`
+	Type                      string                 `json:"type"`
+	Sku                       string                 `json:"sku"`
+	Purchase                  string                 `json:"purchase"`
+	PurchaseDate              time.Time              `json:"purchaseDate"`
+	Platform                  Platform               `json:"platform"`
+	Group                     string                 `json:"group"`
+	GroupName                 string                 `json:"groupName"`
+	Price                     float64                `json:"price"`
+	Currency                  string                 `json:"currency"`
+	ExpirationDate            time.Time              `json:"expirationDate"`
+	IsSubscriptionRenewable   bool                   `json:"isSubscriptionRenewable"`
+	IsSubscriptionRetryPeriod bool                   `json:"isSubscriptionRetryPeriod"`
+	IsSubscriptionGracePeriod bool                   `json:"isSubscriptionGracePeriod"`
+	SubscriptionState         SubscriptionState      `json:"subscriptionState"`
+	SubscriptionPeriodType    SubscriptionPeriodType `json:"subscriptionPeriodType"`
 }
 
 type LatestUser struct {
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -245,6 +246,20 @@ func dummyUser() iaphub.User {
 				Sku:      "sku2",
 				Purchase: "id2",
 			},
+			{
+				Id:                      "3",
+				Type:                    "renewable_subscription",
+				Sku:                     "sku3",
+				Purchase:                "id3",
+				PurchaseDate:            time.Date(2019, 10, 12, 17, 34, 33, 0, time.UTC),
+				Platform:                iaphub.PlatformAndroid,
+				Group:                   "group1",
+				GroupName:               "premium",
+				ExpirationDate:          time.Date(2019, 11, 12, 17, 34, 33, 0, time.UTC),
+				IsSubscriptionRenewable: true,
+				SubscriptionState:       iaphub.SubscriptionStateActive,
+				SubscriptionPeriodType:  iaphub.SubscriptionPeriodTypeNormal,
+			},
 		},
 	}
 }
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"sort"
+	"time"
+)
+
+// Prefix of the ids of the events built by a Backfill
+const backfillEventPrefix = "backfill"
+
+// BackfillReport sums up a backfill run
+type BackfillReport struct {
+	// Number of purchases read
+	Purchases int
+	// Events built from the purchases, in chronological order
+	Events []Event
+	// Number of events handled successfully, always 0 in dry-run mode
+	Handled int
+}
+
+// Backfill rebuilds webhook events from the purchase history, to replay them through a handler
+// such as Dispatcher.Handle after a bug corrupted downstream state.
+type Backfill struct {
+	client iaphub.PurchaseIterator
+	fn     HandlerFunc
+	config *backfillConfig
+}
+
+// NewBackfill returns a Backfill reading purchases with client and passing the events to fn.
+func NewBackfill(client iaphub.PurchaseIterator, fn HandlerFunc, options ...BackfillOption) (*Backfill, error) {
+	if client == nil {
+		return nil, errors.New("client is not specified")
+	} else if fn == nil {
+		return nil, errors.New("handler func is not specified")
+	}
+
+	config := &backfillConfig{
+		now: time.Now,
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Backfill{
+		client: client,
+		fn:     fn,
+		config: config,
+	}, nil
+}
+
+// Run reads the purchases matching the request, builds their events and handles them in chronological order.
+// Each purchase gives a purchase event, or a subscription_renewal event when it renews a previous one,
+// a refund event when refunded and a subscription_expire event when its subscription expired without renewal.
+// Events carry the current state of the purchase and have stable ids, so an idempotency store skips
+// events already replayed by a previous run.
+// Run stops at the first handler error, the report then counts the events handled before it.
+func (b *Backfill) Run(ctx context.Context, request iaphub.GetPurchasesRequest) (BackfillReport, error) {
+	var report BackfillReport
+
+	now := b.config.now()
+	request.Order = iaphub.Ask
+	err := b.client.EachPurchase(request, func(purchase iaphub.Purchase) error {
+		report.Purchases++
+		report.Events = append(report.Events, BackfillEvents(purchase, now)...)
+
+		return ctx.Err()
+	})
+	if err != nil {
+		return report, err
+	}
+
+	sort.SliceStable(report.Events, func(i, j int) bool {
+		return report.Events[i].CreatedDate.Before(report.Events[j].CreatedDate)
+	})
+	if b.config.dryRun {
+		return report, nil
+	}
+
+	ctx = context.WithValue(ctx, backfillKey{}, true)
+	for _, event := range report.Events {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := b.fn(ctx, event); err != nil {
+			return report, fmt.Errorf("event %s: %w", event.Id, err)
+		}
+		report.Handled++
+	}
+
+	return report, nil
+}
+
+// BackfillEvents returns the events IAPHUB sent for the purchase up to now, in chronological order.
+func BackfillEvents(purchase iaphub.Purchase, now time.Time) []Event {
+	var events []Event
+	add := func(eventType EventType, date time.Time) {
+		if date.IsZero() || date.After(now) {
+			return
+		}
+		snapshot := purchase
+		events = append(events, Event{
+			Id:          fmt.Sprintf("%s-%s-%s", backfillEventPrefix, purchase.Id, eventType),
+			Type:        eventType,
+			Version:     generatedEventVersion,
+			App:         purchase.App,
+			Environment: environmentOf(purchase),
+			CreatedDate: date,
+			Data:        EventData{UserId: purchase.UserId, Purchase: &snapshot},
+		})
+	}
+
+	if purchase.IsSubscription && purchase.LinkedPurchase != "" {
+		add(EventTypeSubscriptionRenewal, purchase.PurchaseDate)
+	} else {
+		add(EventTypePurchase, purchase.PurchaseDate)
+	}
+	if purchase.IsRefunded {
+		add(EventTypeRefund, purchase.RefundDate)
+	}
+	if purchase.IsSubscription && purchase.NextPurchase == "" && !purchase.IsSubscriptionActive {
+		add(EventTypeSubscriptionExpire, purchase.ExpirationDate)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedDate.Before(events[j].CreatedDate)
+	})
+
+	return events
+}
+
+type backfillKey struct{}
+
+// IsBackfill reports whether the event handled with ctx was built by a Backfill,
+// e.g. to skip notifying users again.
+func IsBackfill(ctx context.Context) bool {
+	backfill, _ := ctx.Value(backfillKey{}).(bool)
+
+	return backfill
+}
+
+// UseDryRun makes Run build the events without handling them.
+func UseDryRun() BackfillOption {
+	return func(c *backfillConfig) error {
+		c.dryRun = true
+
+		return nil
+	}
+}
+
+// UseBackfillClock sets the clock deciding which events already happened (time.Now by default).
+func UseBackfillClock(now func() time.Time) BackfillOption {
+	return func(c *backfillConfig) error {
+		if now == nil {
+			return errors.New("clock is not specified")
+		}
+		c.now = now
+
+		return nil
+	}
+}
+
+type backfillConfig struct {
+	dryRun bool
+	now    func() time.Time
+}
+
+type BackfillOption func(*backfillConfig) error
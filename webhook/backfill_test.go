@@ -0,0 +1,102 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type purchaseIterator func(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error
+
+func (f purchaseIterator) EachPurchase(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error {
+	return f(request, fn)
+}
+
+func TestBackfill_Run(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2019-10-12T17:00:00Z")
+	history := []iaphub.Purchase{
+		{Id: "sub-1", PurchaseDate: start, ExpirationDate: start.AddDate(0, 1, 0), IsSubscription: true, NextPurchase: "sub-2"},
+		{Id: "coin-1", PurchaseDate: start.AddDate(0, 0, 3), IsRefunded: true, RefundDate: start.AddDate(0, 0, 40)},
+		{Id: "sub-2", PurchaseDate: start.AddDate(0, 1, 0), ExpirationDate: start.AddDate(0, 2, 0), IsSubscription: true, LinkedPurchase: "sub-1"},
+		{Id: "sub-3", PurchaseDate: start.AddDate(0, 1, 5), ExpirationDate: start.AddDate(0, 2, 5), IsSubscription: true, IsSubscriptionActive: true},
+	}
+	client := purchaseIterator(func(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error {
+		if request.Order != iaphub.Ask || !request.FromDate.Equal(start) {
+			t.Errorf("wrong request: %#v", request)
+		}
+		for _, purchase := range history {
+			if err := fn(purchase); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	now := func() time.Time { return start.AddDate(0, 2, 1) }
+
+	var handled []string
+	backfill, err := webhook.NewBackfill(client, func(ctx context.Context, event webhook.Event) error {
+		if !webhook.IsBackfill(ctx) {
+			t.Errorf("context is not marked as backfill")
+		}
+		handled = append(handled, event.Id)
+		return nil
+	}, webhook.UseBackfillClock(now))
+	if err != nil {
+		t.Fatalf("NewBackfill failed: %s", err)
+	}
+
+	report, err := backfill.Run(context.Background(), iaphub.GetPurchasesRequest{FromDate: start})
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	expected := []string{
+		"backfill-sub-1-purchase",
+		"backfill-coin-1-purchase",
+		"backfill-sub-2-subscription_renewal",
+		"backfill-sub-3-purchase",
+		"backfill-coin-1-refund",
+		"backfill-sub-2-subscription_expire",
+	}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Errorf("wrong handled events; expected:\n%v\ngot:\n%v\n", expected, handled)
+	}
+	if report.Purchases != 4 || report.Handled != 6 || len(report.Events) != 6 {
+		t.Errorf("wrong report: %d purchases, %d handled, %d events", report.Purchases, report.Handled, len(report.Events))
+	}
+	if refund := report.Events[4]; refund.Data.Purchase.Id != "coin-1" || !refund.CreatedDate.Equal(start.AddDate(0, 0, 40)) {
+		t.Errorf("wrong refund event: %#v", refund)
+	}
+
+	dryRun, _ := webhook.NewBackfill(client, func(ctx context.Context, event webhook.Event) error {
+		t.Errorf("handler called in dry-run mode")
+		return nil
+	}, webhook.UseBackfillClock(now), webhook.UseDryRun())
+	report, err = dryRun.Run(context.Background(), iaphub.GetPurchasesRequest{FromDate: start})
+	if err != nil || report.Handled != 0 || len(report.Events) != 6 {
+		t.Errorf("wrong dry-run report: %d handled, %d events, error %v", report.Handled, len(report.Events), err)
+	}
+}
+
+func TestBackfill_RunStopsOnError(t *testing.T) {
+	client := purchaseIterator(func(request iaphub.GetPurchasesRequest, fn func(iaphub.Purchase) error) error {
+		_ = fn(iaphub.Purchase{Id: "purchase-1", PurchaseDate: time.Now().Add(-time.Hour)})
+		return fn(iaphub.Purchase{Id: "purchase-2", PurchaseDate: time.Now().Add(-time.Minute)})
+	})
+	failure := errors.New("handler failure")
+	backfill, _ := webhook.NewBackfill(client, func(ctx context.Context, event webhook.Event) error {
+		return failure
+	})
+
+	report, err := backfill.Run(context.Background(), iaphub.GetPurchasesRequest{})
+	if !errors.Is(err, failure) {
+		t.Errorf("wrong error; expected: %s, got: %v", failure, err)
+	}
+	if report.Handled != 0 {
+		t.Errorf("wrong number of handled events: %d", report.Handled)
+	}
+}
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+)
+
+// Dispatcher routes webhook events to the handlers registered for their type.
+// Its Handle method is a HandlerFunc, to be passed to NewHandler.
+//
+// Handlers registered for the same type run in registration order, the first error stops the dispatch
+// and is returned, so that the delivery is retried. Events without handler are acknowledged.
+type Dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[EventType][]HandlerFunc
+	fallback HandlerFunc
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: map[EventType][]HandlerFunc{},
+	}
+}
+
+func (d *Dispatcher) Handle(ctx context.Context, event Event) error {
+	d.mu.RLock()
+	handlers := d.handlers[event.Type]
+	fallback := d.fallback
+	d.mu.RUnlock()
+
+	if len(handlers) == 0 && fallback != nil {
+		return fallback(ctx, event)
+	}
+	for _, fn := range handlers {
+		if err := fn(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// On registers a handler receiving the raw events of a type.
+func (d *Dispatcher) On(eventType EventType, fn HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[eventType] = append(d.handlers[eventType], fn)
+}
+
+// OnUnhandled registers a handler for the events of types without any handler.
+func (d *Dispatcher) OnUnhandled(fn HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fallback = fn
+}
+
+func (d *Dispatcher) OnTest(fn func(ctx context.Context, event TestEvent) error) {
+	d.On(EventTypeTest, func(ctx context.Context, event Event) error {
+		return fn(ctx, TestEvent{Event: event})
+	})
+}
+
+func (d *Dispatcher) OnPurchase(fn func(ctx context.Context, event PurchaseEvent) error) {
+	d.On(EventTypePurchase, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, PurchaseEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnRefund(fn func(ctx context.Context, event RefundEvent) error) {
+	d.On(EventTypeRefund, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, RefundEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionRenewal(fn func(ctx context.Context, event SubscriptionRenewalEvent) error) {
+	d.On(EventTypeSubscriptionRenewal, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionRenewalEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionRenewalRetry(fn func(ctx context.Context, event SubscriptionRenewalRetryEvent) error) {
+	d.On(EventTypeSubscriptionRenewalRetry, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionRenewalRetryEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionGracePeriodExpire(fn func(ctx context.Context, event SubscriptionGracePeriodExpireEvent) error) {
+	d.On(EventTypeSubscriptionGracePeriodExpire, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionGracePeriodExpireEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionExpire(fn func(ctx context.Context, event SubscriptionExpireEvent) error) {
+	d.On(EventTypeSubscriptionExpire, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionExpireEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionPause(fn func(ctx context.Context, event SubscriptionPauseEvent) error) {
+	d.On(EventTypeSubscriptionPause, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionPauseEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionResume(fn func(ctx context.Context, event SubscriptionResumeEvent) error) {
+	d.On(EventTypeSubscriptionResume, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionResumeEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionReplace(fn func(ctx context.Context, event SubscriptionReplaceEvent) error) {
+	d.On(EventTypeSubscriptionReplace, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionReplaceEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionCancel(fn func(ctx context.Context, event SubscriptionCancelEvent) error) {
+	d.On(EventTypeSubscriptionCancel, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionCancelEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnSubscriptionUncancel(fn func(ctx context.Context, event SubscriptionUncancelEvent) error) {
+	d.On(EventTypeSubscriptionUncancel, func(ctx context.Context, event Event) error {
+		purchase, err := event.purchase()
+		if err != nil {
+			return err
+		}
+		return fn(ctx, SubscriptionUncancelEvent{Event: event, Purchase: purchase})
+	})
+}
+
+func (d *Dispatcher) OnUserMigrate(fn func(ctx context.Context, event UserMigrateEvent) error) {
+	d.On(EventTypeUserMigrate, func(ctx context.Context, event Event) error {
+		return fn(ctx, UserMigrateEvent{Event: event, UserId: event.Data.UserId, NewUserId: event.Data.NewUserId})
+	})
+}
@@ -0,0 +1,97 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go/webhook"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDispatcher_Handle(t *testing.T) {
+	var calls []string
+	dispatcher := webhook.NewDispatcher()
+	dispatcher.OnPurchase(func(ctx context.Context, event webhook.PurchaseEvent) error {
+		calls = append(calls, "purchase:"+event.Purchase.Id)
+		return nil
+	})
+	dispatcher.OnPurchase(func(ctx context.Context, event webhook.PurchaseEvent) error {
+		calls = append(calls, "purchase-2:"+event.Id)
+		return nil
+	})
+	dispatcher.OnRefund(func(ctx context.Context, event webhook.RefundEvent) error {
+		calls = append(calls, "refund:"+event.Purchase.Id)
+		return nil
+	})
+	dispatcher.OnUserMigrate(func(ctx context.Context, event webhook.UserMigrateEvent) error {
+		calls = append(calls, "migrate:"+event.UserId+">"+event.NewUserId)
+		return nil
+	})
+
+	purchase := dummyEvent()
+	refund := dummyEvent()
+	refund.Type = webhook.EventTypeRefund
+	migrate := webhook.Event{Id: "event-2", Type: webhook.EventTypeUserMigrate, Data: webhook.EventData{UserId: "old", NewUserId: "new"}}
+	unknown := webhook.Event{Id: "event-3", Type: webhook.EventTypeSubscriptionPause}
+
+	for _, event := range []webhook.Event{purchase, refund, migrate, unknown} {
+		if err := dispatcher.Handle(context.Background(), event); err != nil {
+			t.Errorf("Handle failed for %s: %s", event.Type, err)
+		}
+	}
+
+	expected := []string{"purchase:purchase-1", "purchase-2:event-1", "refund:purchase-1", "migrate:old>new"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("wrong calls; expected:\n%v\ngot:\n%v\n", expected, calls)
+	}
+}
+
+func TestDispatcher_HandleUnhandled(t *testing.T) {
+	var unhandled []webhook.EventType
+	dispatcher := webhook.NewDispatcher()
+	dispatcher.OnTest(func(ctx context.Context, event webhook.TestEvent) error {
+		return nil
+	})
+	dispatcher.OnUnhandled(func(ctx context.Context, event webhook.Event) error {
+		unhandled = append(unhandled, event.Type)
+		return nil
+	})
+
+	_ = dispatcher.Handle(context.Background(), webhook.Event{Id: "event-1", Type: webhook.EventTypeTest})
+	_ = dispatcher.Handle(context.Background(), webhook.Event{Id: "event-2", Type: "new_type"})
+
+	if !reflect.DeepEqual(unhandled, []webhook.EventType{"new_type"}) {
+		t.Errorf("wrong unhandled events: %v", unhandled)
+	}
+}
+
+func TestDispatcher_ErrorsMapToStatus(t *testing.T) {
+	dispatcher := webhook.NewDispatcher()
+	dispatcher.OnPurchase(func(ctx context.Context, event webhook.PurchaseEvent) error {
+		return errors.New("cannot grant access")
+	})
+	dispatcher.OnRefund(func(ctx context.Context, event webhook.RefundEvent) error {
+		return &webhook.StatusError{Code: http.StatusServiceUnavailable, Err: errors.New("maintenance")}
+	})
+	handler, _ := webhook.NewHandler(token, dispatcher.Handle)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"handler error", eventBody, http.StatusInternalServerError},
+		{"status error", `{"id":"event-1","type":"refund","data":{"purchase":{"id":"purchase-1"}}}`, http.StatusServiceUnavailable},
+		{"missing purchase", `{"id":"event-1","type":"purchase","data":{}}`, http.StatusBadRequest},
+		{"unhandled", `{"id":"event-1","type":"subscription_expire","data":{}}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(handler, http.MethodPost, token, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("wrong status; expected: %d, got: %d", tt.status, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"net/http"
+	"time"
+)
+
+// Type of the webhook event
+type EventType string
+
+const (
+	EventTypeTest                          EventType = "test"
+	EventTypePurchase                      EventType = "purchase"
+	EventTypeRefund                        EventType = "refund"
+	EventTypeSubscriptionRenewal           EventType = "subscription_renewal"
+	EventTypeSubscriptionRenewalRetry      EventType = "subscription_renewal_retry"
+	EventTypeSubscriptionGracePeriodExpire EventType = "subscription_grace_period_expire"
+	EventTypeSubscriptionExpire            EventType = "subscription_expire"
+	EventTypeSubscriptionPause             EventType = "subscription_pause"
+	EventTypeSubscriptionResume            EventType = "subscription_resume"
+	EventTypeSubscriptionReplace           EventType = "subscription_replace"
+	EventTypeSubscriptionCancel            EventType = "subscription_cancel"
+	EventTypeSubscriptionUncancel          EventType = "subscription_uncancel"
+	EventTypeUserMigrate                   EventType = "user_migrate"
+)
+
+// Event is the envelope of a webhook sent by IAPHUB
+type Event struct {
+	Id          string     `json:"id"`
+	Type        EventType  `json:"type"`
+	Version     string     `json:"version"`
+	App         string     `json:"app"`
+	Environment iaphub.Env `json:"environment"`
+	CreatedDate time.Time  `json:"createdDate"`
+	Data        EventData  `json:"data"`
+}
+
+// EventData is the payload of a webhook event, the fields set depend on the event type
+type EventData struct {
+	UserId      string              `json:"userId,omitempty"`
+	User        *iaphub.User        `json:"user,omitempty"`
+	Purchase    *iaphub.Purchase    `json:"purchase,omitempty"`
+	Transaction *iaphub.Transaction `json:"transaction,omitempty"`
+	// New id of the user, only set for user migrations
+	NewUserId string `json:"newUserId,omitempty"`
+}
+
+// Sent from the IAPHUB dashboard to check the webhook configuration
+type TestEvent struct {
+	Event
+}
+
+// A product was purchased
+type PurchaseEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// A purchase was refunded
+type RefundEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// A subscription was renewed, Purchase is the new period
+type SubscriptionRenewalEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// The renewal of a subscription failed, the store keeps retrying to charge the user
+type SubscriptionRenewalRetryEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// The grace period of a subscription ended without a successful renewal
+type SubscriptionGracePeriodExpireEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// A subscription expired
+type SubscriptionExpireEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// A subscription was paused until Purchase.AutoResumeDate (Android only)
+type SubscriptionPauseEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// A paused subscription was resumed
+type SubscriptionResumeEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// A subscription was replaced by another product, Purchase is the new subscription
+type SubscriptionReplaceEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// The auto-renewal of a subscription was turned off
+type SubscriptionCancelEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// The auto-renewal of a subscription was turned back on
+type SubscriptionUncancelEvent struct {
+	Event
+	Purchase iaphub.Purchase
+}
+
+// The purchases of a user were migrated to a new user id
+type UserMigrateEvent struct {
+	Event
+	UserId    string
+	NewUserId string
+}
+
+// purchase returns the purchase of the event, or a 400 StatusError when the payload has none
+func (e Event) purchase() (iaphub.Purchase, error) {
+	if e.Data.Purchase == nil {
+		return iaphub.Purchase{}, &StatusError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("purchase is missing from %s event %s", e.Type, e.Id),
+		}
+	}
+
+	return *e.Data.Purchase, nil
+}
+
+// StatusError is returned by a HandlerFunc to reply with a specific non-2xx status code.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,416 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Destination is where a Forwarder relays events: an HTTP endpoint or a Go channel
+type Destination struct {
+	Name string
+	// URL events are posted to as JSON
+	Url string
+	// Token sent in the X-Auth-Token header of the posts, if any
+	Token string
+	// Channel events are sent to, instead of an URL
+	Channel chan<- Event
+	Filter  Filter
+}
+
+// Filter selects events, an empty list matches everything
+type Filter struct {
+	Types     []EventType
+	Platforms []iaphub.Platform
+	Skus      []string
+}
+
+// Match reports whether the event matches every list of the filter.
+// Events without purchase only match filters without platforms and skus.
+func (f Filter) Match(event Event) bool {
+	if len(f.Types) > 0 && !containsType(f.Types, event.Type) {
+		return false
+	}
+	if len(f.Platforms) == 0 && len(f.Skus) == 0 {
+		return true
+	}
+
+	purchase := event.Data.Purchase
+	if purchase == nil {
+		return false
+	}
+	if len(f.Platforms) > 0 && !containsPlatform(f.Platforms, purchase.Platform) {
+		return false
+	}
+	if len(f.Skus) > 0 && !containsString(f.Skus, purchase.ProductSku) {
+		return false
+	}
+
+	return true
+}
+
+// DeliveryMetrics are the counters of a destination
+type DeliveryMetrics struct {
+	// Events queued for the destination
+	Enqueued int64
+	// Events rejected because the queue was full
+	Dropped int64
+	// Events delivered
+	Delivered int64
+	// Failed delivery attempts that were retried
+	Retries int64
+	// Events given up after the last attempt failed
+	Failed int64
+	// Events waiting in the queue
+	Queued int64
+}
+
+type destinationQueue struct {
+	destination Destination
+	queue       chan Event
+	enqueued    int64
+	dropped     int64
+	delivered   int64
+	retries     int64
+	failed      int64
+}
+
+// Forwarder relays verified webhook events to several destinations.
+// Each destination has its own queue and worker, so a slow or failing destination does not delay the others.
+// Its Handle method is a HandlerFunc.
+type Forwarder struct {
+	queues []*destinationQueue
+	config *forwarderConfig
+	mu     sync.RWMutex
+	closed bool
+	stop   chan struct{}
+	// Context of the deliveries, cancelled when the forwarder is aborted
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewForwarder(destinations []Destination, options ...ForwarderOption) (*Forwarder, error) {
+	if len(destinations) == 0 {
+		return nil, errors.New("no destination specified")
+	}
+
+	config := &forwarderConfig{
+		queueSize:   1000,
+		maxAttempts: 5,
+		backoff:     time.Second,
+		maxBackoff:  time.Minute,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f := &Forwarder{
+		config: config,
+		stop:   make(chan struct{}),
+	}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	names := map[string]bool{}
+	for _, d := range destinations {
+		if d.Name == "" || names[d.Name] {
+			return nil, fmt.Errorf("destination name %q is empty or duplicated", d.Name)
+		} else if (d.Url == "") == (d.Channel == nil) {
+			return nil, fmt.Errorf("destination %q needs either an URL or a channel", d.Name)
+		}
+		names[d.Name] = true
+		f.queues = append(f.queues, &destinationQueue{destination: d, queue: make(chan Event, config.queueSize)})
+	}
+
+	for _, q := range f.queues {
+		f.wg.Add(1)
+		go f.work(q)
+	}
+
+	return f, nil
+}
+
+// Handle queues the event for every destination whose filter matches it.
+// It returns a 503 StatusError when a queue is full, so that IAPHUB retries the delivery later;
+// destinations whose queue had room may then receive the event twice.
+func (f *Forwarder) Handle(ctx context.Context, event Event) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return &StatusError{Code: http.StatusServiceUnavailable, Err: errors.New("forwarder is closed")}
+	}
+
+	var full []string
+	for _, q := range f.queues {
+		if !q.destination.Filter.Match(event) {
+			continue
+		}
+		select {
+		case q.queue <- event:
+			atomic.AddInt64(&q.enqueued, 1)
+		default:
+			atomic.AddInt64(&q.dropped, 1)
+			full = append(full, q.destination.Name)
+		}
+	}
+	if len(full) > 0 {
+		return &StatusError{Code: http.StatusServiceUnavailable, Err: fmt.Errorf("queue of %v is full", full)}
+	}
+
+	return nil
+}
+
+// Metrics returns the counters of each destination, by name.
+func (f *Forwarder) Metrics() map[string]DeliveryMetrics {
+	metrics := make(map[string]DeliveryMetrics, len(f.queues))
+	for _, q := range f.queues {
+		metrics[q.destination.Name] = DeliveryMetrics{
+			Enqueued:  atomic.LoadInt64(&q.enqueued),
+			Dropped:   atomic.LoadInt64(&q.dropped),
+			Delivered: atomic.LoadInt64(&q.delivered),
+			Retries:   atomic.LoadInt64(&q.retries),
+			Failed:    atomic.LoadInt64(&q.failed),
+			Queued:    int64(len(q.queue)),
+		}
+	}
+
+	return metrics
+}
+
+// Close stops accepting events and waits until the queued events are delivered.
+// When ctx is done first, deliveries in progress are cancelled, the remaining events are counted as failed
+// and ctx.Err() is returned.
+func (f *Forwarder) Close(ctx context.Context) error {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		for _, q := range f.queues {
+			close(q.queue)
+		}
+	}
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		f.abort()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (f *Forwarder) abort() {
+	select {
+	case <-f.stop:
+	default:
+		close(f.stop)
+		f.cancel()
+	}
+}
+
+func (f *Forwarder) work(q *destinationQueue) {
+	defer f.wg.Done()
+
+	for event := range q.queue {
+		if f.aborted() {
+			f.abandon(q)
+			return
+		}
+		for attempt := 1; ; attempt++ {
+			err := f.deliver(q.destination, event)
+			if err == nil {
+				atomic.AddInt64(&q.delivered, 1)
+				break
+			} else if attempt >= f.config.maxAttempts {
+				atomic.AddInt64(&q.failed, 1)
+				break
+			}
+			atomic.AddInt64(&q.retries, 1)
+
+			timer := time.NewTimer(f.backoff(attempt))
+			select {
+			case <-timer.C:
+			case <-f.stop:
+				timer.Stop()
+				f.abandon(q)
+				return
+			}
+		}
+	}
+}
+
+// backoff returns the delay before the retry following the attempt, doubled for each attempt up to the max backoff
+func (f *Forwarder) backoff(attempt int) time.Duration {
+	backoff := f.config.backoff
+	for i := 1; i < attempt && backoff < f.config.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > f.config.maxBackoff {
+		backoff = f.config.maxBackoff
+	}
+
+	return backoff
+}
+
+func (f *Forwarder) aborted() bool {
+	select {
+	case <-f.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// abandon counts the current event and the ones left in the queue as failed,
+// the queue is closed once the forwarder is aborted
+func (f *Forwarder) abandon(q *destinationQueue) {
+	atomic.AddInt64(&q.failed, 1)
+	for range q.queue {
+		atomic.AddInt64(&q.failed, 1)
+	}
+}
+
+func (f *Forwarder) deliver(d Destination, event Event) error {
+	if d.Channel != nil {
+		select {
+		case d.Channel <- event:
+			return nil
+		case <-f.stop:
+			return errors.New("forwarder was aborted")
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodPost, d.Url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.Token != "" {
+		req.Header.Set(TokenHeader, d.Token)
+	}
+
+	resp, err := f.config.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s replied %d", d.Name, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func containsType(types []EventType, t EventType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsPlatform(platforms []iaphub.Platform, p iaphub.Platform) bool {
+	for _, v := range platforms {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UseQueueSize sets how many events each destination queue holds (1000 by default).
+func UseQueueSize(size int) ForwarderOption {
+	return func(c *forwarderConfig) error {
+		if size <= 0 {
+			return errors.New("queue size must be positive")
+		}
+		c.queueSize = size
+
+		return nil
+	}
+}
+
+// UseDeliveryRetries sets the number of delivery attempts per event and the delay before the first retry,
+// doubled for each following retry up to the max backoff (5 attempts from one second by default).
+func UseDeliveryRetries(maxAttempts int, backoff time.Duration) ForwarderOption {
+	return func(c *forwarderConfig) error {
+		if maxAttempts <= 0 || backoff <= 0 {
+			return errors.New("attempts and backoff must be positive")
+		}
+		c.maxAttempts = maxAttempts
+		c.backoff = backoff
+
+		return nil
+	}
+}
+
+// UseDeliveryMaxBackoff sets the maximum delay between two delivery attempts (one minute by default).
+func UseDeliveryMaxBackoff(max time.Duration) ForwarderOption {
+	return func(c *forwarderConfig) error {
+		if max <= 0 {
+			return errors.New("max backoff must be positive")
+		}
+		c.maxBackoff = max
+
+		return nil
+	}
+}
+
+// UseDeliveryClient sets the HTTP client posting events to URL destinations (a client with a 30 seconds timeout by default).
+func UseDeliveryClient(httpClient *http.Client) ForwarderOption {
+	return func(c *forwarderConfig) error {
+		if httpClient == nil {
+			return errors.New("HTTP client is not specified")
+		}
+		c.client = httpClient
+
+		return nil
+	}
+}
+
+type forwarderConfig struct {
+	queueSize   int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	client      *http.Client
+}
+
+type ForwarderOption func(*forwarderConfig) error
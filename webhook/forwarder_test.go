@@ -0,0 +1,198 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForwarder(t *testing.T) {
+	var mu sync.Mutex
+	var posted []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.Header.Get(webhook.TokenHeader) != "analytics-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event webhook.Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		posted = append(posted, event.Id)
+	}))
+	defer server.Close()
+
+	refunds := make(chan webhook.Event, 10)
+	forwarder, err := webhook.NewForwarder([]webhook.Destination{
+		{Name: "analytics", Url: server.URL, Token: "analytics-token"},
+		{Name: "support", Channel: refunds, Filter: webhook.Filter{Types: []webhook.EventType{webhook.EventTypeRefund}}},
+		{Name: "android-gold", Channel: make(chan webhook.Event, 10), Filter: webhook.Filter{
+			Platforms: []iaphub.Platform{iaphub.PlatformAndroid},
+			Skus:      []string{"gold"},
+		}},
+	}, webhook.UseDeliveryRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %s", err)
+	}
+
+	purchase := dummyEvent()
+	refund := dummyEvent()
+	refund.Id = "event-2"
+	refund.Type = webhook.EventTypeRefund
+	for _, event := range []webhook.Event{purchase, refund} {
+		if err := forwarder.Handle(context.Background(), event); err != nil {
+			t.Errorf("Handle failed: %s", err)
+		}
+	}
+
+	if err := forwarder.Close(context.Background()); err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(posted, []string{"event-1", "event-2"}) {
+		t.Errorf("wrong posted events: %v", posted)
+	}
+	if len(refunds) != 1 || (<-refunds).Id != "event-2" {
+		t.Errorf("wrong refund events")
+	}
+
+	expected := map[string]webhook.DeliveryMetrics{
+		"analytics":    {Enqueued: 2, Delivered: 2, Retries: 1},
+		"support":      {Enqueued: 1, Delivered: 1},
+		"android-gold": {},
+	}
+	if metrics := forwarder.Metrics(); !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("wrong metrics; expected:\n%#v\ngot:\n%#v\n", expected, metrics)
+	}
+
+	if err := forwarder.Handle(context.Background(), purchase); err == nil {
+		t.Errorf("expected error after Close")
+	}
+}
+
+func TestForwarder_QueueFull(t *testing.T) {
+	blocked := make(chan webhook.Event)
+	forwarder, _ := webhook.NewForwarder([]webhook.Destination{
+		{Name: "blocked", Channel: blocked},
+	}, webhook.UseQueueSize(1), webhook.UseDeliveryRetries(1, time.Millisecond))
+
+	handler, _ := webhook.NewHandler(token, forwarder.Handle)
+	codes := []int{serve(handler, http.MethodPost, token, eventBody).Code}
+	// Wait for the worker to hold the first event, the queue then has room for a single other one
+	for forwarder.Metrics()["blocked"].Queued != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	codes = append(codes, serve(handler, http.MethodPost, token, eventBody).Code)
+	codes = append(codes, serve(handler, http.MethodPost, token, eventBody).Code)
+
+	expectedCodes := []int{http.StatusOK, http.StatusOK, http.StatusServiceUnavailable}
+	if !reflect.DeepEqual(codes, expectedCodes) {
+		t.Errorf("wrong statuses; expected: %v, got: %v", expectedCodes, codes)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := forwarder.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wrong Close error; expected: %s, got: %v", context.DeadlineExceeded, err)
+	}
+	if metrics := forwarder.Metrics()["blocked"]; metrics.Dropped != 1 || metrics.Failed != 2 {
+		t.Errorf("wrong metrics: %#v", metrics)
+	}
+}
+
+func TestForwarder_CloseAbortsDeliveries(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	forwarder, _ := webhook.NewForwarder([]webhook.Destination{
+		{Name: "slow", Url: server.URL},
+	}, webhook.UseDeliveryRetries(1, time.Millisecond))
+	for _, id := range []string{"event-1", "event-2", "event-3"} {
+		event := dummyEvent()
+		event.Id = id
+		_ = forwarder.Handle(context.Background(), event)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := forwarder.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("wrong Close error; expected: %s, got: %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close took too long: %s", elapsed)
+	}
+	if metrics := forwarder.Metrics()["slow"]; metrics.Delivered != 0 || metrics.Failed != 3 {
+		t.Errorf("wrong metrics: %#v", metrics)
+	}
+}
+
+func TestForwarder_MaxBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// Past 64 attempts, an uncapped doubling of the backoff overflows
+	forwarder, _ := webhook.NewForwarder([]webhook.Destination{
+		{Name: "down", Url: server.URL},
+	}, webhook.UseDeliveryRetries(70, time.Millisecond), webhook.UseDeliveryMaxBackoff(2*time.Millisecond))
+	_ = forwarder.Handle(context.Background(), dummyEvent())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := forwarder.Close(ctx); err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+
+	expected := webhook.DeliveryMetrics{Enqueued: 1, Failed: 1, Retries: 69}
+	if metrics := forwarder.Metrics()["down"]; !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("wrong metrics; expected:\n%#v\ngot:\n%#v\n", expected, metrics)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	event := dummyEvent()
+
+	tests := []struct {
+		name   string
+		filter webhook.Filter
+		event  webhook.Event
+		match  bool
+	}{
+		{"empty", webhook.Filter{}, event, true},
+		{"type", webhook.Filter{Types: []webhook.EventType{webhook.EventTypePurchase}}, event, true},
+		{"other type", webhook.Filter{Types: []webhook.EventType{webhook.EventTypeRefund}}, event, false},
+		{"platform", webhook.Filter{Platforms: []iaphub.Platform{iaphub.PlatformIOS}}, event, true},
+		{"other platform", webhook.Filter{Platforms: []iaphub.Platform{iaphub.PlatformAndroid}}, event, false},
+		{"sku", webhook.Filter{Skus: []string{"membership_pricing1"}}, event, true},
+		{"no purchase", webhook.Filter{Skus: []string{"membership_pricing1"}}, webhook.Event{Type: webhook.EventTypeTest}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if match := tt.filter.Match(tt.event); match != tt.match {
+				t.Errorf("wrong match; expected: %t, got: %t", tt.match, match)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"sync"
+	"time"
+)
+
+// What to do with events older than the latest known state of their subscription
+type StalePolicy int
+
+const (
+	// Process stale events, handlers can check IsStale
+	StaleProcess StalePolicy = iota
+	// Acknowledge stale events without calling the handler
+	StaleDrop
+	// Replace the purchase of stale events with the current subscription, fetched with GetSubscription
+	StaleRefetch
+)
+
+// SubscriptionSnapshot is the latest known state of a subscription, keyed by its original purchase
+type SubscriptionSnapshot struct {
+	OriginalPurchase string    `json:"originalPurchase"`
+	PurchaseId       string    `json:"purchaseId"`
+	LinkedPurchase   string    `json:"linkedPurchase"`
+	ExpirationDate   time.Time `json:"expirationDate"`
+	EventDate        time.Time `json:"eventDate"`
+}
+
+// FreshnessStore keeps the latest known state of each subscription
+type FreshnessStore interface {
+	Get(originalPurchase string) (SubscriptionSnapshot, bool, error)
+	Put(snapshot SubscriptionSnapshot) error
+}
+
+// SubscriptionGetter fetches the current state of a subscription, it is implemented by iaphub.Client
+type SubscriptionGetter interface {
+	GetSubscription(request iaphub.GetSubscriptionRequest) (iaphub.Subscription, error)
+}
+
+type MemoryFreshnessStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]SubscriptionSnapshot
+}
+
+func NewMemoryFreshnessStore() *MemoryFreshnessStore {
+	return &MemoryFreshnessStore{
+		snapshots: map[string]SubscriptionSnapshot{},
+	}
+}
+
+func (s *MemoryFreshnessStore) Get(originalPurchase string) (SubscriptionSnapshot, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot, ok := s.snapshots[originalPurchase]
+
+	return snapshot, ok, nil
+}
+
+func (s *MemoryFreshnessStore) Put(snapshot SubscriptionSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[snapshot.OriginalPurchase] = snapshot
+
+	return nil
+}
+
+// FreshnessTracker detects webhook events that arrive after newer events of the same subscription.
+//
+// An event is stale when the latest known purchase of its subscription is the NextPurchase of the event purchase
+// or links back to it, when its purchase expires before the latest known one, or when it is about the same period
+// but was created before the latest known event.
+//
+// Refunds are about their own purchase: a refund of an earlier period is not stale, and Wrap never drops
+// a refund or replaces its purchase.
+type FreshnessTracker struct {
+	mu     sync.Mutex
+	store  FreshnessStore
+	client SubscriptionGetter
+}
+
+// NewFreshnessTracker creates a tracker, client is only required by the StaleRefetch policy.
+func NewFreshnessTracker(store FreshnessStore, client SubscriptionGetter) (*FreshnessTracker, error) {
+	if store == nil {
+		return nil, errors.New("freshness store is not specified")
+	}
+
+	return &FreshnessTracker{
+		store:  store,
+		client: client,
+	}, nil
+}
+
+// IsStale reports whether the event is older than the latest known state of its subscription.
+// Events without purchase are never stale.
+func (t *FreshnessTracker) IsStale(event Event) (bool, error) {
+	snapshot, ok := snapshotOf(event)
+	if !ok {
+		return false, nil
+	}
+
+	known, found, err := t.store.Get(snapshot.OriginalPurchase)
+	if err != nil || !found {
+		return false, err
+	}
+	if event.Type == EventTypeRefund && known.PurchaseId != snapshot.PurchaseId {
+		return false, nil
+	}
+
+	return isOlder(snapshot, *event.Data.Purchase, known), nil
+}
+
+// Observe records the state carried by the event, unless the known state is newer.
+func (t *FreshnessTracker) Observe(event Event) error {
+	snapshot, ok := snapshotOf(event)
+	if !ok {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	known, found, err := t.store.Get(snapshot.OriginalPurchase)
+	if err != nil {
+		return err
+	} else if found && isOlder(snapshot, *event.Data.Purchase, known) {
+		return nil
+	}
+
+	return t.store.Put(snapshot)
+}
+
+// Wrap returns a HandlerFunc applying the policy to stale events before calling fn,
+// and recording the state of the events fn processed successfully.
+func (t *FreshnessTracker) Wrap(fn HandlerFunc, policy StalePolicy) HandlerFunc {
+	return func(ctx context.Context, event Event) error {
+		stale, err := t.IsStale(event)
+		if err != nil {
+			return err
+		}
+
+		if stale && event.Type != EventTypeRefund {
+			switch policy {
+			case StaleDrop:
+				return nil
+			case StaleRefetch:
+				if event, err = t.refetch(event); err != nil {
+					return err
+				}
+				stale = false
+			}
+		}
+
+		if err = fn(context.WithValue(ctx, staleKey{}, stale), event); err != nil {
+			return err
+		}
+
+		return t.Observe(event)
+	}
+}
+
+func (t *FreshnessTracker) refetch(event Event) (Event, error) {
+	if t.client == nil {
+		return event, errors.New("client is required to refetch stale events")
+	}
+
+	purchase := event.Data.Purchase
+	originalPurchase := purchase.OriginalPurchase
+	if originalPurchase == "" {
+		originalPurchase = purchase.Id
+	}
+
+	subscription, err := t.client.GetSubscription(iaphub.GetSubscriptionRequest{OriginalPurchaseId: originalPurchase})
+	if err != nil {
+		return event, err
+	}
+	event.Data.Purchase = &subscription
+
+	return event, nil
+}
+
+type staleKey struct{}
+
+// IsStale reports whether the event handled with ctx was stale.
+// It is only set for handlers wrapped by FreshnessTracker.Wrap.
+func IsStale(ctx context.Context) bool {
+	stale, _ := ctx.Value(staleKey{}).(bool)
+
+	return stale
+}
+
+func snapshotOf(event Event) (SubscriptionSnapshot, bool) {
+	purchase := event.Data.Purchase
+	if purchase == nil || purchase.Id == "" {
+		return SubscriptionSnapshot{}, false
+	}
+
+	originalPurchase := purchase.OriginalPurchase
+	if originalPurchase == "" {
+		originalPurchase = purchase.Id
+	}
+
+	return SubscriptionSnapshot{
+		OriginalPurchase: originalPurchase,
+		PurchaseId:       purchase.Id,
+		LinkedPurchase:   purchase.LinkedPurchase,
+		ExpirationDate:   purchase.ExpirationDate,
+		EventDate:        event.CreatedDate,
+	}, true
+}
+
+func isOlder(snapshot SubscriptionSnapshot, purchase iaphub.Purchase, known SubscriptionSnapshot) bool {
+	if known.PurchaseId != snapshot.PurchaseId {
+		if purchase.NextPurchase != "" && purchase.NextPurchase == known.PurchaseId {
+			return true
+		} else if known.LinkedPurchase == snapshot.PurchaseId {
+			return true
+		}
+	}
+
+	if !snapshot.ExpirationDate.IsZero() && !known.ExpirationDate.IsZero() && !snapshot.ExpirationDate.Equal(known.ExpirationDate) {
+		return snapshot.ExpirationDate.Before(known.ExpirationDate)
+	}
+
+	return snapshot.EventDate.Before(known.EventDate)
+}
@@ -0,0 +1,200 @@
+package webhook_test
+
+import (
+	"context"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"testing"
+	"time"
+)
+
+type subscriptionGetter func(request iaphub.GetSubscriptionRequest) (iaphub.Subscription, error)
+
+func (f subscriptionGetter) GetSubscription(request iaphub.GetSubscriptionRequest) (iaphub.Subscription, error) {
+	return f(request)
+}
+
+func TestFreshnessTracker_IsStale(t *testing.T) {
+	tracker, _ := webhook.NewFreshnessTracker(webhook.NewMemoryFreshnessStore(), nil)
+	first, renewal := renewalEvents()
+
+	if err := tracker.Observe(renewal); err != nil {
+		t.Fatalf("Observe failed: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		event webhook.Event
+		stale bool
+	}{
+		{"previous period with next purchase", first, true},
+		{"previous period without linkage", withPurchase(first, func(p *iaphub.Purchase) { p.NextPurchase = "" }), true},
+		{"same period created earlier", withCreatedDate(renewal, renewal.CreatedDate.Add(-time.Minute)), true},
+		{"same period created later", withCreatedDate(renewal, renewal.CreatedDate.Add(time.Minute)), false},
+		{"later period", withPurchase(renewal, func(p *iaphub.Purchase) {
+			p.Id = "purchase-3"
+			p.ExpirationDate = p.ExpirationDate.AddDate(0, 1, 0)
+		}), false},
+		{"other subscription", withPurchase(first, func(p *iaphub.Purchase) { p.OriginalPurchase = "other" }), false},
+		{"no purchase", webhook.Event{Id: "event-9", Type: webhook.EventTypeTest}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale, err := tracker.IsStale(tt.event)
+			if err != nil {
+				t.Errorf("IsStale failed: %s", err)
+			}
+			if stale != tt.stale {
+				t.Errorf("wrong staleness; expected: %t, got: %t", tt.stale, stale)
+			}
+		})
+	}
+}
+
+func TestFreshnessTracker_Wrap(t *testing.T) {
+	first, renewal := renewalEvents()
+	current := *renewal.Data.Purchase
+
+	tests := []struct {
+		name             string
+		policy           webhook.StalePolicy
+		expectedCalls    int
+		expectedStale    bool
+		expectedPurchase string
+	}{
+		{"process", webhook.StaleProcess, 2, true, "purchase-1"},
+		{"drop", webhook.StaleDrop, 1, false, "purchase-2"},
+		{"refetch", webhook.StaleRefetch, 2, false, "purchase-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := subscriptionGetter(func(request iaphub.GetSubscriptionRequest) (iaphub.Subscription, error) {
+				if request.OriginalPurchaseId != "purchase-1" {
+					t.Errorf("wrong original purchase: %s", request.OriginalPurchaseId)
+				}
+				return current, nil
+			})
+			tracker, _ := webhook.NewFreshnessTracker(webhook.NewMemoryFreshnessStore(), client)
+
+			calls := 0
+			var lastStale bool
+			var lastPurchase string
+			handle := tracker.Wrap(func(ctx context.Context, event webhook.Event) error {
+				calls++
+				lastStale = webhook.IsStale(ctx)
+				lastPurchase = event.Data.Purchase.Id
+				return nil
+			}, tt.policy)
+
+			for _, event := range []webhook.Event{renewal, first} {
+				if err := handle(context.Background(), event); err != nil {
+					t.Errorf("handler failed: %s", err)
+				}
+			}
+
+			if calls != tt.expectedCalls || lastStale != tt.expectedStale || lastPurchase != tt.expectedPurchase {
+				t.Errorf("wrong handling; expected: %d calls, stale %t, purchase %s, got: %d calls, stale %t, purchase %s",
+					tt.expectedCalls, tt.expectedStale, tt.expectedPurchase, calls, lastStale, lastPurchase)
+			}
+
+			// The stale event must not overwrite the known state
+			stale, _ := tracker.IsStale(first)
+			if !stale {
+				t.Errorf("known state was overwritten by a stale event")
+			}
+		})
+	}
+}
+
+// renewalEvents returns the expiration of a first period, then the renewal replacing it
+func renewalEvents() (webhook.Event, webhook.Event) {
+	purchaseDate, _ := time.Parse(time.RFC3339, "2019-10-12T17:34:33Z")
+
+	first := webhook.Event{
+		Id:          "event-1",
+		Type:        webhook.EventTypeSubscriptionExpire,
+		CreatedDate: purchaseDate.AddDate(0, 1, 0),
+		Data: webhook.EventData{
+			Purchase: &iaphub.Purchase{
+				Id:               "purchase-1",
+				PurchaseDate:     purchaseDate,
+				ExpirationDate:   purchaseDate.AddDate(0, 1, 0),
+				NextPurchase:     "purchase-2",
+				OriginalPurchase: "purchase-1",
+			},
+		},
+	}
+	renewal := webhook.Event{
+		Id:          "event-2",
+		Type:        webhook.EventTypeSubscriptionRenewal,
+		CreatedDate: purchaseDate.AddDate(0, 1, 0),
+		Data: webhook.EventData{
+			Purchase: &iaphub.Purchase{
+				Id:               "purchase-2",
+				PurchaseDate:     purchaseDate.AddDate(0, 1, 0),
+				ExpirationDate:   purchaseDate.AddDate(0, 2, 0),
+				LinkedPurchase:   "purchase-1",
+				OriginalPurchase: "purchase-1",
+			},
+		},
+	}
+
+	return first, renewal
+}
+
+func withPurchase(event webhook.Event, change func(p *iaphub.Purchase)) webhook.Event {
+	purchase := *event.Data.Purchase
+	change(&purchase)
+	event.Data.Purchase = &purchase
+
+	return event
+}
+
+func withCreatedDate(event webhook.Event, createdDate time.Time) webhook.Event {
+	event.CreatedDate = createdDate
+
+	return event
+}
+
+func TestFreshnessTracker_LateRefund(t *testing.T) {
+	first, renewal := renewalEvents()
+	refund := withPurchase(first, func(p *iaphub.Purchase) {
+		p.IsRefunded = true
+	})
+	refund.Id = "event-3"
+	refund.Type = webhook.EventTypeRefund
+	refund.CreatedDate = renewal.CreatedDate.Add(time.Hour)
+
+	for _, policy := range []webhook.StalePolicy{webhook.StaleProcess, webhook.StaleDrop, webhook.StaleRefetch} {
+		client := subscriptionGetter(func(request iaphub.GetSubscriptionRequest) (iaphub.Subscription, error) {
+			t.Errorf("unexpected refetch of %s", request.OriginalPurchaseId)
+			return *renewal.Data.Purchase, nil
+		})
+		tracker, _ := webhook.NewFreshnessTracker(webhook.NewMemoryFreshnessStore(), client)
+
+		var refunded []string
+		handle := tracker.Wrap(func(ctx context.Context, event webhook.Event) error {
+			if event.Type == webhook.EventTypeRefund {
+				if webhook.IsStale(ctx) {
+					t.Errorf("refund of an earlier period is stale")
+				}
+				refunded = append(refunded, event.Data.Purchase.Id)
+			}
+			return nil
+		}, policy)
+
+		for _, event := range []webhook.Event{renewal, refund} {
+			if err := handle(context.Background(), event); err != nil {
+				t.Errorf("handler failed: %s", err)
+			}
+		}
+
+		if len(refunded) != 1 || refunded[0] != "purchase-1" {
+			t.Errorf("wrong refunded purchases with policy %d: %v", policy, refunded)
+		}
+		// The refund of the earlier period must not overwrite the known state
+		if stale, _ := tracker.IsStale(first); !stale {
+			t.Errorf("known state was overwritten by the refund with policy %d", policy)
+		}
+	}
+}
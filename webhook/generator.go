@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/n10ty/iaphub-go"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Version of the events built by NewEvent
+const generatedEventVersion = "2"
+
+// NewEvent builds an event of the given type for local testing, from a purchase template.
+// The purchase is updated to match the event, e.g. refund events get a refund date and reason,
+// and the event is dated now. User migration events get the purchase user id, their NewUserId has to be set.
+func NewEvent(eventType EventType, template iaphub.Purchase) Event {
+	return newEventAt(eventType, template, time.Now().UTC())
+}
+
+// Lifecycle builds the events of a whole subscription lifecycle from a purchase template, in chronological order:
+// the purchase, the given number of renewals, the cancellation and the expiration.
+// The period of the subscription is the one of the template, one month when it has no expiration date.
+func Lifecycle(template iaphub.Purchase, renewals int) []Event {
+	purchase := template
+	if purchase.PurchaseDate.IsZero() {
+		purchase.PurchaseDate = time.Now().UTC()
+	}
+	if purchase.Id == "" {
+		purchase.Id = randomId()
+	}
+	period := purchase.ExpirationDate.Sub(purchase.PurchaseDate)
+	if purchase.ExpirationDate.IsZero() || period <= 0 {
+		period = 0
+		purchase.ExpirationDate = purchase.PurchaseDate.AddDate(0, 1, 0)
+	}
+	purchase.ProductType = iaphub.ProductTypeRenewableSubscription
+	purchase.IsSubscription = true
+	purchase.OriginalPurchase = purchase.Id
+	purchase.LinkedPurchase = ""
+	purchase.NextPurchase = ""
+
+	events := []Event{newEventAt(EventTypePurchase, purchase, purchase.PurchaseDate)}
+	for i := 0; i < renewals; i++ {
+		previous := purchase
+		purchase.Id = randomId()
+		purchase.PurchaseDate = previous.ExpirationDate
+		purchase.ExpirationDate = nextExpiration(previous.ExpirationDate, period)
+		purchase.LinkedPurchase = previous.Id
+		purchase.SubscriptionPeriodType = iaphub.SubscriptionPeriodTypeNormal
+		purchase.IsTrialConversion = previous.SubscriptionPeriodType == iaphub.SubscriptionPeriodTypeTrial
+		events = append(events, newEventAt(EventTypeSubscriptionRenewal, purchase, purchase.PurchaseDate))
+	}
+
+	cancelDate := purchase.PurchaseDate.Add(purchase.ExpirationDate.Sub(purchase.PurchaseDate) / 2)
+	events = append(events, newEventAt(EventTypeSubscriptionCancel, purchase, cancelDate))
+	purchase.IsSubscriptionRenewable = false
+	purchase.SubscriptionCancelReason = iaphub.SubscriptionCancelReasonCustomerCancelled
+	events = append(events, newEventAt(EventTypeSubscriptionExpire, purchase, purchase.ExpirationDate))
+
+	return events
+}
+
+// Send posts an event to a webhook URL with the token, as IAPHUB does.
+// It uses http.DefaultClient when httpClient is nil.
+func Send(httpClient *http.Client, url string, token string, event Event) error {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TokenHeader, token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{Code: resp.StatusCode, Err: fmt.Errorf("%d: %s", resp.StatusCode, bytes.TrimSpace(message))}
+	}
+
+	return nil
+}
+
+// ParseEventType returns the known event type with the given name.
+func ParseEventType(name string) (EventType, error) {
+	for _, t := range EventTypes() {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+
+	return "", errors.New("unknown event type " + name)
+}
+
+// EventTypes returns every known event type.
+func EventTypes() []EventType {
+	return []EventType{
+		EventTypeTest,
+		EventTypePurchase,
+		EventTypeRefund,
+		EventTypeSubscriptionRenewal,
+		EventTypeSubscriptionRenewalRetry,
+		EventTypeSubscriptionGracePeriodExpire,
+		EventTypeSubscriptionExpire,
+		EventTypeSubscriptionPause,
+		EventTypeSubscriptionResume,
+		EventTypeSubscriptionReplace,
+		EventTypeSubscriptionCancel,
+		EventTypeSubscriptionUncancel,
+		EventTypeUserMigrate,
+	}
+}
+
+func newEventAt(eventType EventType, template iaphub.Purchase, date time.Time) Event {
+	event := Event{
+		Id:          randomId(),
+		Type:        eventType,
+		Version:     generatedEventVersion,
+		App:         template.App,
+		Environment: environmentOf(template),
+		CreatedDate: date,
+		Data:        EventData{UserId: template.UserId},
+	}
+	if eventType == EventTypeTest || eventType == EventTypeUserMigrate {
+		return event
+	}
+
+	purchase := template
+	if purchase.Tags != nil {
+		purchase.Tags = copyTags(purchase.Tags)
+	}
+	switch eventType {
+	case EventTypePurchase, EventTypeSubscriptionRenewal, EventTypeSubscriptionUncancel, EventTypeSubscriptionResume:
+		purchase.SubscriptionState = iaphub.SubscriptionStateActive
+		purchase.IsSubscriptionActive = purchase.IsSubscription
+		purchase.IsSubscriptionRenewable = purchase.IsSubscription
+		purchase.SubscriptionCancelReason = ""
+		purchase.AutoResumeDate = time.Time{}
+	case EventTypeRefund:
+		purchase.IsRefunded = true
+		purchase.RefundDate = date
+		if purchase.RefundReason == "" {
+			purchase.RefundReason = iaphub.RefundReasonOther
+		}
+		purchase.RefundAmount = purchase.Price
+		purchase.ConvertedRefundAmount = purchase.ConvertedPrice
+		purchase.IsSubscriptionActive = false
+	case EventTypeSubscriptionRenewalRetry:
+		purchase.SubscriptionState = iaphub.SubscriptionStateRetryPeriod
+		purchase.IsSubscriptionRetryPeriod = true
+		purchase.IsSubscriptionActive = false
+	case EventTypeSubscriptionGracePeriodExpire:
+		purchase.SubscriptionState = iaphub.SubscriptionStateRetryPeriod
+		purchase.IsSubscriptionGracePeriod = false
+		purchase.IsSubscriptionRetryPeriod = true
+		purchase.IsSubscriptionActive = false
+	case EventTypeSubscriptionExpire:
+		purchase.SubscriptionState = iaphub.SubscriptionStateExpired
+		purchase.IsSubscriptionActive = false
+	case EventTypeSubscriptionPause:
+		purchase.SubscriptionState = iaphub.SubscriptionStatePaused
+		purchase.IsSubscriptionActive = false
+		if purchase.AutoResumeDate.IsZero() {
+			purchase.AutoResumeDate = date.AddDate(0, 1, 0)
+		}
+	case EventTypeSubscriptionReplace:
+		purchase.SubscriptionCancelReason = iaphub.SubscriptionCancelReasonSubscriptionReplaced
+	case EventTypeSubscriptionCancel:
+		purchase.IsSubscriptionRenewable = false
+		purchase.SubscriptionCancelReason = iaphub.SubscriptionCancelReasonCustomerCancelled
+	}
+	event.Data.Purchase = &purchase
+
+	return event
+}
+
+func environmentOf(purchase iaphub.Purchase) iaphub.Env {
+	if purchase.IsSandbox {
+		return "sandbox"
+	}
+
+	return iaphub.EnvProduction
+}
+
+func nextExpiration(expiration time.Time, period time.Duration) time.Time {
+	if period == 0 {
+		return expiration.AddDate(0, 1, 0)
+	}
+
+	return expiration.Add(period)
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+
+	return copied
+}
+
+func randomId() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%024x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package webhook_test
+
+import (
+	"context"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNewEventAllTypes(t *testing.T) {
+	var received []webhook.EventType
+	handler, _ := webhook.NewHandler(token, func(ctx context.Context, event webhook.Event) error {
+		received = append(received, event.Type)
+		return nil
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	template := *dummyEvent().Data.Purchase
+	for _, eventType := range webhook.EventTypes() {
+		event := webhook.NewEvent(eventType, template)
+		if event.Id == "" || event.Type != eventType || event.Data.UserId != template.UserId {
+			t.Errorf("wrong %s event: %#v", eventType, event)
+		}
+		if err := webhook.Send(nil, server.URL, token, event); err != nil {
+			t.Errorf("Send failed for %s: %s", eventType, err)
+		}
+	}
+
+	if !reflect.DeepEqual(received, webhook.EventTypes()) {
+		t.Errorf("wrong received events; expected:\n%v\ngot:\n%v\n", webhook.EventTypes(), received)
+	}
+
+	refund := webhook.NewEvent(webhook.EventTypeRefund, template)
+	if !refund.Data.Purchase.IsRefunded || refund.Data.Purchase.RefundDate.IsZero() || template.IsRefunded {
+		t.Errorf("wrong refund purchase: %#v", refund.Data.Purchase)
+	}
+}
+
+func TestSendWrongToken(t *testing.T) {
+	handler, _ := webhook.NewHandler(token, func(ctx context.Context, event webhook.Event) error {
+		return nil
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	err := webhook.Send(nil, server.URL, "wrong-token", webhook.NewEvent(webhook.EventTypeTest, iaphub.Purchase{}))
+	statusErr, ok := err.(*webhook.StatusError)
+	if !ok || statusErr.Code != http.StatusUnauthorized {
+		t.Errorf("wrong error; expected status %d, got: %v", http.StatusUnauthorized, err)
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	template := *dummyEvent().Data.Purchase
+	events := webhook.Lifecycle(template, 2)
+
+	expectedTypes := []webhook.EventType{
+		webhook.EventTypePurchase,
+		webhook.EventTypeSubscriptionRenewal,
+		webhook.EventTypeSubscriptionRenewal,
+		webhook.EventTypeSubscriptionCancel,
+		webhook.EventTypeSubscriptionExpire,
+	}
+	var types []webhook.EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Fatalf("wrong lifecycle; expected:\n%v\ngot:\n%v\n", expectedTypes, types)
+	}
+
+	first := events[0].Data.Purchase
+	period := first.ExpirationDate.Sub(first.PurchaseDate)
+	previous := first
+	for i, event := range events[1:3] {
+		purchase := event.Data.Purchase
+		if purchase.LinkedPurchase != previous.Id || purchase.OriginalPurchase != first.Id {
+			t.Errorf("renewal %d is not linked to the previous period: %#v", i+1, purchase)
+		}
+		if !purchase.PurchaseDate.Equal(previous.ExpirationDate) || !purchase.ExpirationDate.Equal(previous.ExpirationDate.Add(period)) {
+			t.Errorf("wrong dates for renewal %d: %s - %s", i+1, purchase.PurchaseDate, purchase.ExpirationDate)
+		}
+		previous = purchase
+	}
+
+	expired := events[4].Data.Purchase
+	if expired.IsSubscriptionRenewable || expired.SubscriptionState != iaphub.SubscriptionStateExpired || !events[4].CreatedDate.Equal(expired.ExpirationDate) {
+		t.Errorf("wrong expired purchase: %#v", expired)
+	}
+
+	// Replayed in order, none of the events is stale
+	tracker, _ := webhook.NewFreshnessTracker(webhook.NewMemoryFreshnessStore(), nil)
+	for _, event := range events {
+		if stale, _ := tracker.IsStale(event); stale {
+			t.Errorf("%s event is stale", event.Type)
+		}
+		_ = tracker.Observe(event)
+	}
+}
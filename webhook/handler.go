@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Header holding the webhook token configured in IAPHUB
+const TokenHeader = "X-Auth-Token"
+
+const defaultMaxBodySize = 1 << 20
+
+// HandlerFunc processes a verified webhook event.
+// Returning an error makes the handler reply with a non-2xx status so that IAPHUB retries the delivery.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Handler is an http.Handler receiving IAPHUB webhooks.
+//
+// It replies with:
+//   - 200 when the event was processed, or was already processed
+//   - 400 when the body is not a valid event
+//   - 401 when the token is missing or wrong
+//   - 405 for methods other than POST
+//   - 409 when the same event is being processed by another delivery
+//   - 413 when the body exceeds the maximum size
+//   - 500 when the HandlerFunc failed, or the code of a StatusError it returned
+type Handler struct {
+	tokenHash [sha256.Size]byte
+	fn        HandlerFunc
+	config    *config
+}
+
+func NewHandler(token string, fn HandlerFunc, options ...Option) (*Handler, error) {
+	if token == "" {
+		return nil, errors.New("webhook token is not specified")
+	} else if fn == nil {
+		return nil, errors.New("handler func is not specified")
+	}
+
+	config := &config{
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Handler{
+		tokenHash: sha256.Sum256([]byte(token)),
+		fn:        fn,
+		config:    config,
+	}, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.verifyToken(r.Header.Get(TokenHeader)) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	event, status, err := h.readEvent(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	token := ""
+	if store := h.config.idempotencyStore; store != nil {
+		token, err = store.Begin(event.Id)
+		switch err {
+		case nil:
+		case ErrEventProcessed:
+			w.WriteHeader(http.StatusOK)
+			return
+		case ErrEventInProgress:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		default:
+			http.Error(w, "idempotency check failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.process(r.Context(), event, token); err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Code >= 300 {
+			http.Error(w, statusErr.Error(), statusErr.Code)
+			return
+		}
+		http.Error(w, "event processing failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// process runs the HandlerFunc, recording the outcome in the idempotency store if any with the token of the lock.
+// The event is acknowledged even if it cannot be marked as processed, as a retry would process it twice.
+func (h *Handler) process(ctx context.Context, event Event, token string) error {
+	err := h.fn(ctx, event)
+
+	if store := h.config.idempotencyStore; store != nil {
+		if err != nil {
+			store.Abort(event.Id, token)
+		} else {
+			store.Complete(event.Id, token)
+		}
+	}
+
+	return err
+}
+
+// verifyToken compares hashes of the tokens so that neither their content nor their length leaks through timing.
+func (h *Handler) verifyToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(token))
+
+	return subtle.ConstantTimeCompare(hash[:], h.tokenHash[:]) == 1
+}
+
+func (h *Handler) readEvent(body io.Reader) (Event, int, error) {
+	var event Event
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, h.config.maxBodySize+1))
+	if err != nil {
+		return event, http.StatusBadRequest, errors.New("cannot read body")
+	} else if int64(len(data)) > h.config.maxBodySize {
+		return event, http.StatusRequestEntityTooLarge, errors.New("body too large")
+	}
+
+	if err = json.Unmarshal(data, &event); err != nil {
+		return event, http.StatusBadRequest, errors.New("invalid event")
+	} else if event.Id == "" || event.Type == "" {
+		return event, http.StatusBadRequest, errors.New("event id or type is missing")
+	}
+
+	return event, http.StatusOK, nil
+}
+
+// UseMaxBodySize sets the maximum size of a webhook body in bytes (1 MiB by default).
+func UseMaxBodySize(size int64) Option {
+	return func(c *config) error {
+		if size <= 0 {
+			return errors.New("maximum body size must be positive")
+		}
+		c.maxBodySize = size
+
+		return nil
+	}
+}
+
+// UseIdempotencyStore skips events already processed, and replies 409 to deliveries of an event being processed.
+func UseIdempotencyStore(store IdempotencyStore) Option {
+	return func(c *config) error {
+		if store == nil {
+			return errors.New("idempotency store is not specified")
+		}
+		c.idempotencyStore = store
+
+		return nil
+	}
+}
+
+type config struct {
+	maxBodySize      int64
+	idempotencyStore IdempotencyStore
+}
+
+type Option func(*config) error
@@ -0,0 +1,132 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go"
+	"github.com/n10ty/iaphub-go/webhook"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	token     = "webhook-token-1"
+	eventBody = `{"id":"event-1","type":"purchase","version":"2","app":"app-id-1","environment":"production","createdDate":"2019-10-12T17:34:35.256Z","data":{"userId":"user-id-1","purchase":{"id":"purchase-1","purchaseDate":"2019-10-12T17:34:33.256Z","userId":"user-id-1","productSku":"membership_pricing1","productType":"renewable_subscription","platform":"ios","expirationDate":"2019-11-12T17:34:33.256Z","originalPurchase":"purchase-1"}}}`
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	var received []webhook.Event
+	handler, err := webhook.NewHandler(token, func(ctx context.Context, event webhook.Event) error {
+		received = append(received, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("NewHandler failed: %s", err)
+	}
+
+	rec := serve(handler, http.MethodPost, token, eventBody)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("wrong status; expected: %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if len(received) != 1 || !reflect.DeepEqual(received[0], dummyEvent()) {
+		t.Errorf("wrong event; expected:\n%#v\ngot:\n%#v\n", dummyEvent(), received)
+	}
+}
+
+func TestHandler_ServeHTTPErrors(t *testing.T) {
+	failing := errors.New("database is down")
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		handlerErr error
+		status     int
+	}{
+		{"wrong method", http.MethodGet, token, eventBody, nil, http.StatusMethodNotAllowed},
+		{"missing token", http.MethodPost, "", eventBody, nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "webhook-token-2", eventBody, nil, http.StatusUnauthorized},
+		{"token prefix", http.MethodPost, token[:5], eventBody, nil, http.StatusUnauthorized},
+		{"invalid JSON", http.MethodPost, token, `{"id":`, nil, http.StatusBadRequest},
+		{"missing type", http.MethodPost, token, `{"id":"event-1"}`, nil, http.StatusBadRequest},
+		{"body too large", http.MethodPost, token, `{"id":"event-1","type":"test","data":{"userId":"` + strings.Repeat("a", 1024) + `"}}`, nil, http.StatusRequestEntityTooLarge},
+		{"handler error", http.MethodPost, token, eventBody, failing, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler, _ := webhook.NewHandler(token, func(ctx context.Context, event webhook.Event) error {
+				called = true
+				return tt.handlerErr
+			}, webhook.UseMaxBodySize(1024))
+
+			rec := serve(handler, tt.method, tt.token, tt.body)
+
+			if rec.Code != tt.status {
+				t.Errorf("wrong status; expected: %d, got: %d", tt.status, rec.Code)
+			}
+			if called != (tt.handlerErr != nil) {
+				t.Errorf("wrong handler call; called: %t", called)
+			}
+		})
+	}
+}
+
+func TestNewHandlerErrors(t *testing.T) {
+	fn := func(ctx context.Context, event webhook.Event) error { return nil }
+
+	if _, err := webhook.NewHandler("", fn); err == nil {
+		t.Errorf("expected error for missing token")
+	}
+	if _, err := webhook.NewHandler(token, nil); err == nil {
+		t.Errorf("expected error for missing handler func")
+	}
+	if _, err := webhook.NewHandler(token, fn, webhook.UseMaxBodySize(0)); err == nil {
+		t.Errorf("expected error for invalid body size")
+	}
+}
+
+func serve(handler http.Handler, method string, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/webhook", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set(webhook.TokenHeader, token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func dummyEvent() webhook.Event {
+	createdDate, _ := time.Parse(time.RFC3339, "2019-10-12T17:34:35.256Z")
+	purchaseDate, _ := time.Parse(time.RFC3339, "2019-10-12T17:34:33.256Z")
+	expirationDate, _ := time.Parse(time.RFC3339, "2019-11-12T17:34:33.256Z")
+
+	return webhook.Event{
+		Id:          "event-1",
+		Type:        "purchase",
+		Version:     "2",
+		App:         "app-id-1",
+		Environment: iaphub.EnvProduction,
+		CreatedDate: createdDate,
+		Data: webhook.EventData{
+			UserId: "user-id-1",
+			Purchase: &iaphub.Purchase{
+				Id:               "purchase-1",
+				PurchaseDate:     purchaseDate,
+				UserId:           "user-id-1",
+				ProductSku:       "membership_pricing1",
+				ProductType:      iaphub.ProductTypeRenewableSubscription,
+				Platform:         iaphub.PlatformIOS,
+				ExpirationDate:   expirationDate,
+				OriginalPurchase: "purchase-1",
+			},
+		},
+	}
+}
@@ -0,0 +1,329 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEventInProgress is returned by IdempotencyStore.Begin while another delivery of the event is processed
+	ErrEventInProgress = errors.New("event is being processed")
+	// ErrEventProcessed is returned by IdempotencyStore.Begin when the event was already processed
+	ErrEventProcessed = errors.New("event was already processed")
+)
+
+// IdempotencyStore records which events were processed, so that duplicate deliveries are skipped.
+//
+// Begin returns a token identifying the lock. Once a lock expired and was taken over by another delivery,
+// the token of the previous holder no longer releases it.
+type IdempotencyStore interface {
+	// Begin locks the event for processing. It returns ErrEventInProgress if the event is locked
+	// by another delivery and ErrEventProcessed if the event was already processed.
+	Begin(eventId string) (token string, err error)
+	// Complete marks a locked event as processed, and releases the lock if the token still holds it.
+	Complete(eventId string, token string) error
+	// Abort releases the lock of an event whose processing failed, so that a later delivery can process it.
+	// It does nothing when the token no longer holds the lock.
+	Abort(eventId string, token string) error
+}
+
+type idempotencyEntry struct {
+	processed bool
+	token     string
+	expires   time.Time
+}
+
+// MemoryIdempotencyStore keeps processed events in memory for a TTL.
+// Locks expire after the lock timeout, so that an event is not blocked forever by a crashed delivery.
+type MemoryIdempotencyStore struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	lockTimeout time.Duration
+	entries     map[string]idempotencyEntry
+	nextSweep   time.Time
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration, lockTimeout time.Duration) (*MemoryIdempotencyStore, error) {
+	if err := validateDurations(ttl, lockTimeout); err != nil {
+		return nil, err
+	}
+
+	return &MemoryIdempotencyStore{
+		ttl:         ttl,
+		lockTimeout: lockTimeout,
+		entries:     map[string]idempotencyEntry{},
+	}, nil
+}
+
+func (s *MemoryIdempotencyStore) Begin(eventId string) (string, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[eventId]; ok && now.Before(entry.expires) {
+		if entry.processed {
+			return "", ErrEventProcessed
+		}
+		return "", ErrEventInProgress
+	}
+	s.entries[eventId] = idempotencyEntry{token: token, expires: now.Add(s.lockTimeout)}
+
+	return token, nil
+}
+
+// Complete records the event as processed even when the lock was taken over, as the event was processed:
+// later deliveries are skipped, while the current holder keeps running.
+func (s *MemoryIdempotencyStore) Complete(eventId string, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[eventId] = idempotencyEntry{processed: true, expires: time.Now().Add(s.ttl)}
+
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Abort(eventId string, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.entries[eventId]; ok && !entry.processed && entry.token == token {
+		delete(s.entries, eventId)
+	}
+
+	return nil
+}
+
+// sweep drops expired entries, at most once per lock timeout
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for id, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, id)
+		}
+	}
+	s.nextSweep = now.Add(s.lockTimeout)
+}
+
+// FileIdempotencyStore keeps one file per event in a directory, so that it survives restarts
+// and can be shared by several processes on the same host.
+// Locks are files created exclusively, and expire after the lock timeout.
+type FileIdempotencyStore struct {
+	dir         string
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+func NewFileIdempotencyStore(dir string, ttl time.Duration, lockTimeout time.Duration) (*FileIdempotencyStore, error) {
+	if dir == "" {
+		return nil, errors.New("directory is not specified")
+	} else if err := validateDurations(ttl, lockTimeout); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileIdempotencyStore{
+		dir:         dir,
+		ttl:         ttl,
+		lockTimeout: lockTimeout,
+	}, nil
+}
+
+// Begin creates the lock file exclusively and writes the token of the lock in it.
+func (s *FileIdempotencyStore) Begin(eventId string) (string, error) {
+	donePath, lockPath := s.paths(eventId)
+	if err := s.checkDone(donePath); err != nil {
+		return "", err
+	}
+	token, err := newLockToken()
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.WriteString(token)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				// Another delivery may have completed the event between the first check and the lock
+				err = s.checkDone(donePath)
+			}
+			if err != nil {
+				s.release(lockPath, token)
+				return "", err
+			}
+			return token, nil
+		} else if !os.IsExist(err) {
+			return "", err
+		}
+
+		info, err := os.Stat(lockPath)
+		if os.IsNotExist(err) {
+			// The lock was released in the meantime
+			continue
+		} else if err != nil {
+			return "", err
+		} else if time.Since(info.ModTime()) < s.lockTimeout {
+			return "", ErrEventInProgress
+		}
+		if err = s.takeOver(lockPath, info); err != nil {
+			return "", err
+		}
+	}
+
+	return "", ErrEventInProgress
+}
+
+// checkDone returns ErrEventProcessed if the event was processed within the TTL
+func (s *FileIdempotencyStore) checkDone(donePath string) error {
+	info, err := os.Stat(donePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if time.Since(info.ModTime()) < s.ttl {
+		return ErrEventProcessed
+	}
+	if err = os.Remove(donePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// takeOver removes the expired lock: it is renamed first, so that only one process removes it,
+// and put back if it turns out to be a new lock taken by another process since it was found expired.
+func (s *FileIdempotencyStore) takeOver(lockPath string, expired os.FileInfo) error {
+	stalePath := fmt.Sprintf("%s.%d-%d.stale", lockPath, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(lockPath, stalePath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer os.Remove(stalePath)
+
+	info, err := os.Stat(stalePath)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, expired) {
+		if err = os.Link(stalePath, lockPath); err != nil && !os.IsExist(err) {
+			return err
+		}
+		return ErrEventInProgress
+	}
+
+	return nil
+}
+
+// Complete records the event as processed even when the lock was taken over, as the event was processed,
+// but only removes the lock file if it still holds the token.
+func (s *FileIdempotencyStore) Complete(eventId string, token string) error {
+	donePath, lockPath := s.paths(eventId)
+	if err := ioutil.WriteFile(donePath, []byte(eventId), 0o644); err != nil {
+		return err
+	}
+
+	return s.release(lockPath, token)
+}
+
+func (s *FileIdempotencyStore) Abort(eventId string, token string) error {
+	_, lockPath := s.paths(eventId)
+
+	return s.release(lockPath, token)
+}
+
+// release removes the lock file if it holds the token. Like takeOver, the file is renamed first
+// and put back if it turns out to be the lock of another delivery.
+func (s *FileIdempotencyStore) release(lockPath string, token string) error {
+	data, err := ioutil.ReadFile(lockPath)
+	if os.IsNotExist(err) || (err == nil && string(data) != token) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	releasedPath := fmt.Sprintf("%s.%d-%d.released", lockPath, os.Getpid(), time.Now().UnixNano())
+	if err = os.Rename(lockPath, releasedPath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer os.Remove(releasedPath)
+
+	if data, err = ioutil.ReadFile(releasedPath); err != nil {
+		return err
+	}
+	if string(data) != token {
+		if err = os.Link(releasedPath, lockPath); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prune removes the files of events processed longer than the TTL ago.
+func (s *FileIdempotencyStore) Prune() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".done" && time.Since(f.ModTime()) >= s.ttl {
+			if err := os.Remove(filepath.Join(s.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// newLockToken returns a random token identifying a lock
+func newLockToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+func validateDurations(ttl time.Duration, lockTimeout time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	} else if lockTimeout <= 0 {
+		return errors.New("lock timeout must be positive")
+	}
+
+	return nil
+}
+
+// paths returns the files of an event, named after a hash of its id as ids are not safe file names
+func (s *FileIdempotencyStore) paths(eventId string) (donePath string, lockPath string) {
+	sum := sha256.Sum256([]byte(eventId))
+	name := filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+
+	return name + ".done", name + ".lock"
+}
@@ -0,0 +1,199 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go/webhook"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStores(t *testing.T) {
+	fileStore, err := webhook.NewFileIdempotencyStore(t.TempDir(), 50*time.Millisecond, 30*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewFileIdempotencyStore failed: %s", err)
+	}
+
+	stores := map[string]webhook.IdempotencyStore{
+		"memory": newMemoryIdempotencyStore(t, 50*time.Millisecond, 30*time.Millisecond),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			token := expectBegin(t, store, "event/1", nil)
+			expectBegin(t, store, "event/1", webhook.ErrEventInProgress)
+
+			_ = store.Abort("event/1", token)
+			token = expectBegin(t, store, "event/1", nil)
+			_ = store.Complete("event/1", token)
+			expectBegin(t, store, "event/1", webhook.ErrEventProcessed)
+			expectBegin(t, store, "event/2", nil)
+
+			// Locks and processed events expire
+			time.Sleep(60 * time.Millisecond)
+			expectBegin(t, store, "event/2", nil)
+			expectBegin(t, store, "event/1", nil)
+		})
+	}
+}
+
+func TestIdempotencyStores_Concurrent(t *testing.T) {
+	fileStore, _ := webhook.NewFileIdempotencyStore(t.TempDir(), time.Hour, 20*time.Millisecond)
+	stores := map[string]webhook.IdempotencyStore{
+		"memory": newMemoryIdempotencyStore(t, time.Hour, 20*time.Millisecond),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// The first lock expires, a single delivery then takes it over and processes the event
+			expectBegin(t, store, "event/1", nil)
+			time.Sleep(30 * time.Millisecond)
+
+			var mu sync.Mutex
+			processed := 0
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					token, err := store.Begin("event/1")
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					processed++
+					mu.Unlock()
+					_ = store.Complete("event/1", token)
+				}()
+			}
+			wg.Wait()
+
+			if processed != 1 {
+				t.Errorf("wrong number of processings; expected: 1, got: %d", processed)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStores_ReleaseAfterTakeOver(t *testing.T) {
+	fileStore, _ := webhook.NewFileIdempotencyStore(t.TempDir(), time.Hour, 20*time.Millisecond)
+	stores := map[string]webhook.IdempotencyStore{
+		"memory": newMemoryIdempotencyStore(t, time.Hour, 20*time.Millisecond),
+		"file":   fileStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// The first delivery takes too long, its lock is taken over by a retry
+			first := expectBegin(t, store, "event/1", nil)
+			time.Sleep(30 * time.Millisecond)
+			second := expectBegin(t, store, "event/1", nil)
+
+			// The first delivery fails, it must not release the lock of the retry
+			if err := store.Abort("event/1", first); err != nil {
+				t.Errorf("Abort failed: %s", err)
+			}
+			expectBegin(t, store, "event/1", webhook.ErrEventInProgress)
+
+			if err := store.Abort("event/1", second); err != nil {
+				t.Errorf("Abort failed: %s", err)
+			}
+			third := expectBegin(t, store, "event/1", nil)
+
+			// A late success of the first delivery records the event as processed
+			if err := store.Complete("event/1", first); err != nil {
+				t.Errorf("Complete failed: %s", err)
+			}
+			_ = store.Abort("event/1", third)
+			expectBegin(t, store, "event/1", webhook.ErrEventProcessed)
+		})
+	}
+}
+
+func TestIdempotencyStores_InvalidDurations(t *testing.T) {
+	if _, err := webhook.NewMemoryIdempotencyStore(time.Hour, 0); err == nil {
+		t.Error("expected error for zero lock timeout")
+	}
+	if _, err := webhook.NewMemoryIdempotencyStore(-time.Hour, time.Minute); err == nil {
+		t.Error("expected error for negative ttl")
+	}
+	if _, err := webhook.NewFileIdempotencyStore(t.TempDir(), time.Hour, 0); err == nil {
+		t.Error("expected error for zero lock timeout")
+	}
+}
+
+func TestHandler_ServeHTTPDeduplicates(t *testing.T) {
+	calls := 0
+	fail := true
+	handler, _ := webhook.NewHandler(token, func(ctx context.Context, event webhook.Event) error {
+		calls++
+		if fail {
+			fail = false
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, webhook.UseIdempotencyStore(newMemoryIdempotencyStore(t, time.Hour, time.Minute)))
+
+	statuses := []int{
+		serve(handler, http.MethodPost, token, eventBody).Code,
+		serve(handler, http.MethodPost, token, eventBody).Code,
+		serve(handler, http.MethodPost, token, eventBody).Code,
+	}
+
+	expected := []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK}
+	for i := range expected {
+		if statuses[i] != expected[i] {
+			t.Errorf("wrong status for delivery %d; expected: %d, got: %d", i+1, expected[i], statuses[i])
+		}
+	}
+	if calls != 2 {
+		t.Errorf("wrong number of handler calls; expected: 2, got: %d", calls)
+	}
+}
+
+func TestHandler_ServeHTTPLocksConcurrentDeliveries(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler, _ := webhook.NewHandler(token, func(ctx context.Context, event webhook.Event) error {
+		close(started)
+		<-release
+		return nil
+	}, webhook.UseIdempotencyStore(newMemoryIdempotencyStore(t, time.Hour, time.Minute)))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var first int
+	go func() {
+		defer wg.Done()
+		first = serve(handler, http.MethodPost, token, eventBody).Code
+	}()
+
+	<-started
+	if code := serve(handler, http.MethodPost, token, eventBody).Code; code != http.StatusConflict {
+		t.Errorf("wrong status for concurrent delivery; expected: %d, got: %d", http.StatusConflict, code)
+	}
+	close(release)
+	wg.Wait()
+
+	if first != http.StatusOK {
+		t.Errorf("wrong status for first delivery; expected: %d, got: %d", http.StatusOK, first)
+	}
+}
+
+func expectBegin(t *testing.T, store webhook.IdempotencyStore, eventId string, expected error) string {
+	t.Helper()
+	token, err := store.Begin(eventId)
+	if err != expected {
+		t.Errorf("wrong Begin result for %s; expected: %v, got: %v", eventId, expected, err)
+	}
+	return token
+}
+
+func newMemoryIdempotencyStore(t *testing.T, ttl time.Duration, lockTimeout time.Duration) *webhook.MemoryIdempotencyStore {
+	store, err := webhook.NewMemoryIdempotencyStore(ttl, lockTimeout)
+	if err != nil {
+		t.Fatalf("NewMemoryIdempotencyStore failed: %s", err)
+	}
+	return store
+}
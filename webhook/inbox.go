@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrMessageNotFound is returned when an inbox has no message for the event id
+var ErrMessageNotFound = errors.New("message not found")
+
+// Message is an event stored in an Inbox, with its processing state
+type Message struct {
+	Event        Event     `json:"event"`
+	ReceivedDate time.Time `json:"receivedDate"`
+	Attempts     int       `json:"attempts"`
+	NextAttempt  time.Time `json:"nextAttempt"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// Inbox durably stores verified events until a Processor handled them.
+//
+// Claimed messages are only hidden from other claims of the same process,
+// after a restart they are claimed again, so events are processed at least once.
+type Inbox interface {
+	// Push stores a new event. Pushing an event already stored, pending or dead, is a no-op.
+	Push(event Event) error
+	// Claim returns the pending message with the earliest due attempt at now, if any.
+	Claim(now time.Time) (Message, bool, error)
+	// Ack removes a processed message.
+	Ack(eventId string) error
+	// Retry releases a claimed message, with its updated attempts, next attempt and last error.
+	Retry(message Message) error
+	// DeadLetter moves a claimed message to the dead-letter queue.
+	DeadLetter(message Message) error
+	// DeadLetters returns the messages of the dead-letter queue, oldest first.
+	DeadLetters() ([]Message, error)
+	// Replay moves a dead letter back to the pending messages, with its attempts reset.
+	Replay(eventId string) error
+}
+
+// Enqueue returns a HandlerFunc pushing events to the inbox, so that the webhook is acknowledged
+// as soon as the event is stored. Events are then handled by a Processor.
+func Enqueue(inbox Inbox) HandlerFunc {
+	return func(ctx context.Context, event Event) error {
+		return inbox.Push(event)
+	}
+}
+
+// inboxState is the in-memory state shared by the inbox implementations, which persist its changes.
+type inboxState struct {
+	mu      sync.Mutex
+	pending map[string]Message
+	dead    map[string]Message
+	claimed map[string]bool
+}
+
+func newInboxState() *inboxState {
+	return &inboxState{
+		pending: map[string]Message{},
+		dead:    map[string]Message{},
+		claimed: map[string]bool{},
+	}
+}
+
+func (s *inboxState) has(eventId string) bool {
+	_, pending := s.pending[eventId]
+	_, dead := s.dead[eventId]
+
+	return pending || dead
+}
+
+func (s *inboxState) next(now time.Time) (Message, bool) {
+	var next Message
+	found := false
+	for id, m := range s.pending {
+		if s.claimed[id] || m.NextAttempt.After(now) {
+			continue
+		}
+		if !found || m.NextAttempt.Before(next.NextAttempt) || (m.NextAttempt.Equal(next.NextAttempt) && m.ReceivedDate.Before(next.ReceivedDate)) {
+			next = m
+			found = true
+		}
+	}
+
+	return next, found
+}
+
+func (s *inboxState) deadLetters() []Message {
+	messages := make([]Message, 0, len(s.dead))
+	for _, m := range s.dead {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ReceivedDate.Before(messages[j].ReceivedDate)
+	})
+
+	return messages
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/n10ty/iaphub-go/internal/fsutil"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileInbox stores one JSON file per message, in a pending and a dead directory.
+type FileInbox struct {
+	dir   string
+	state *inboxState
+}
+
+// NewFileInbox opens the inbox in dir, loading the messages stored by previous runs.
+func NewFileInbox(dir string) (*FileInbox, error) {
+	if dir == "" {
+		return nil, errors.New("directory is not specified")
+	}
+
+	inbox := &FileInbox{dir: dir, state: newInboxState()}
+	for queue, messages := range map[string]map[string]Message{"pending": inbox.state.pending, "dead": inbox.state.dead} {
+		queueDir := filepath.Join(dir, queue)
+		if err := os.MkdirAll(queueDir, 0o755); err != nil {
+			return nil, err
+		}
+		files, err := ioutil.ReadDir(queueDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(queueDir, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			var m Message
+			if err = json.Unmarshal(data, &m); err != nil {
+				return nil, err
+			}
+			messages[m.Event.Id] = m
+		}
+	}
+
+	return inbox, nil
+}
+
+func (i *FileInbox) Push(event Event) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if i.state.has(event.Id) {
+		return nil
+	}
+	now := time.Now()
+	m := Message{Event: event, ReceivedDate: now, NextAttempt: now}
+	if err := i.write("pending", m); err != nil {
+		return err
+	}
+	i.state.pending[event.Id] = m
+
+	return nil
+}
+
+func (i *FileInbox) Claim(now time.Time) (Message, bool, error) {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	m, ok := i.state.next(now)
+	if ok {
+		i.state.claimed[m.Event.Id] = true
+	}
+
+	return m, ok, nil
+}
+
+func (i *FileInbox) Ack(eventId string) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if err := i.remove("pending", eventId); err != nil {
+		return err
+	}
+	delete(i.state.pending, eventId)
+	delete(i.state.claimed, eventId)
+
+	return nil
+}
+
+func (i *FileInbox) Retry(message Message) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if _, ok := i.state.pending[message.Event.Id]; !ok {
+		return ErrMessageNotFound
+	}
+	if err := i.write("pending", message); err != nil {
+		return err
+	}
+	i.state.pending[message.Event.Id] = message
+	delete(i.state.claimed, message.Event.Id)
+
+	return nil
+}
+
+func (i *FileInbox) DeadLetter(message Message) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	id := message.Event.Id
+	if _, ok := i.state.pending[id]; !ok {
+		return ErrMessageNotFound
+	}
+	if err := i.write("dead", message); err != nil {
+		return err
+	}
+	if err := i.remove("pending", id); err != nil {
+		return err
+	}
+	i.state.dead[id] = message
+	delete(i.state.pending, id)
+	delete(i.state.claimed, id)
+
+	return nil
+}
+
+func (i *FileInbox) DeadLetters() ([]Message, error) {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	return i.state.deadLetters(), nil
+}
+
+func (i *FileInbox) Replay(eventId string) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	m, ok := i.state.dead[eventId]
+	if !ok {
+		return ErrMessageNotFound
+	}
+	m.Attempts = 0
+	m.NextAttempt = time.Now()
+	if err := i.write("pending", m); err != nil {
+		return err
+	}
+	if err := i.remove("dead", eventId); err != nil {
+		return err
+	}
+	i.state.pending[eventId] = m
+	delete(i.state.dead, eventId)
+
+	return nil
+}
+
+func (i *FileInbox) write(queue string, m Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(i.path(queue, m.Event.Id), data)
+}
+
+func (i *FileInbox) remove(queue string, eventId string) error {
+	if err := os.Remove(i.path(queue, eventId)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// path returns the file of a message, named after a hash of the event id as ids are not safe file names
+func (i *FileInbox) path(queue string, eventId string) string {
+	sum := sha256.Sum256([]byte(eventId))
+
+	return filepath.Join(i.dir, queue, hex.EncodeToString(sum[:])+".json")
+}
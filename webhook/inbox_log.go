@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	logOpPush   = "push"
+	logOpAck    = "ack"
+	logOpRetry  = "retry"
+	logOpDead   = "dead"
+	logOpReplay = "replay"
+)
+
+type logRecord struct {
+	Op      string  `json:"op"`
+	EventId string  `json:"eventId"`
+	Message Message `json:"message"`
+}
+
+// LogInbox stores messages in an append-only log file of JSON lines, replayed when the inbox is opened.
+// Compact rewrites the log with the current messages only.
+type LogInbox struct {
+	path  string
+	file  *os.File
+	state *inboxState
+}
+
+// NewLogInbox opens the inbox log at path, creating it if needed.
+// A truncated last line, left by a crash during a write, is ignored and removed from the log.
+func NewLogInbox(path string) (*LogInbox, error) {
+	if path == "" {
+		return nil, errors.New("log path is not specified")
+	}
+
+	inbox := &LogInbox{path: path, state: newInboxState()}
+	size, err := inbox.load()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Drop the truncated last line, so that the next record does not get appended to it
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	inbox.file = file
+
+	return inbox, nil
+}
+
+// load replays the log and returns the size of its valid part
+func (i *LogInbox) load() (int64, error) {
+	file, err := os.Open(i.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var size int64
+	var invalid error
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A last line without line feed was not fully written
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+		if invalid != nil {
+			return 0, invalid
+		}
+		var record logRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			invalid = fmt.Errorf("invalid inbox log record at line %d: %s", line, err)
+			continue
+		}
+		i.apply(record)
+		size += int64(len(data))
+	}
+}
+
+func (i *LogInbox) apply(record logRecord) {
+	switch record.Op {
+	case logOpPush, logOpRetry:
+		i.state.pending[record.EventId] = record.Message
+	case logOpAck:
+		delete(i.state.pending, record.EventId)
+	case logOpDead:
+		delete(i.state.pending, record.EventId)
+		i.state.dead[record.EventId] = record.Message
+	case logOpReplay:
+		delete(i.state.dead, record.EventId)
+		i.state.pending[record.EventId] = record.Message
+	}
+}
+
+// append writes a record to the log and applies it to the state
+func (i *LogInbox) append(record logRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = i.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err = i.file.Sync(); err != nil {
+		return err
+	}
+	i.apply(record)
+
+	return nil
+}
+
+func (i *LogInbox) Push(event Event) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if i.state.has(event.Id) {
+		return nil
+	}
+	now := time.Now()
+
+	return i.append(logRecord{Op: logOpPush, EventId: event.Id, Message: Message{Event: event, ReceivedDate: now, NextAttempt: now}})
+}
+
+func (i *LogInbox) Claim(now time.Time) (Message, bool, error) {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	m, ok := i.state.next(now)
+	if ok {
+		i.state.claimed[m.Event.Id] = true
+	}
+
+	return m, ok, nil
+}
+
+func (i *LogInbox) Ack(eventId string) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if _, ok := i.state.pending[eventId]; !ok {
+		return nil
+	}
+	delete(i.state.claimed, eventId)
+
+	return i.append(logRecord{Op: logOpAck, EventId: eventId})
+}
+
+func (i *LogInbox) Retry(message Message) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if _, ok := i.state.pending[message.Event.Id]; !ok {
+		return ErrMessageNotFound
+	}
+	delete(i.state.claimed, message.Event.Id)
+
+	return i.append(logRecord{Op: logOpRetry, EventId: message.Event.Id, Message: message})
+}
+
+func (i *LogInbox) DeadLetter(message Message) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	if _, ok := i.state.pending[message.Event.Id]; !ok {
+		return ErrMessageNotFound
+	}
+	delete(i.state.claimed, message.Event.Id)
+
+	return i.append(logRecord{Op: logOpDead, EventId: message.Event.Id, Message: message})
+}
+
+func (i *LogInbox) DeadLetters() ([]Message, error) {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	return i.state.deadLetters(), nil
+}
+
+func (i *LogInbox) Replay(eventId string) error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	m, ok := i.state.dead[eventId]
+	if !ok {
+		return ErrMessageNotFound
+	}
+	m.Attempts = 0
+	m.NextAttempt = time.Now()
+
+	return i.append(logRecord{Op: logOpReplay, EventId: eventId, Message: m})
+}
+
+// Compact rewrites the log with one record per pending or dead message.
+func (i *LogInbox) Compact() error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(i.path), filepath.Base(i.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	for id, m := range i.state.pending {
+		err = encoder.Encode(logRecord{Op: logOpPush, EventId: id, Message: m})
+		if err != nil {
+			break
+		}
+	}
+	for _, m := range i.state.deadLetters() {
+		if err != nil {
+			break
+		}
+		err = encoder.Encode(logRecord{Op: logOpDead, EventId: m.Event.Id, Message: m})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), i.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	file, err := os.OpenFile(i.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	i.file.Close()
+	i.file = file
+
+	return nil
+}
+
+func (i *LogInbox) Close() error {
+	i.state.mu.Lock()
+	defer i.state.mu.Unlock()
+
+	return i.file.Close()
+}
@@ -0,0 +1,286 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"github.com/n10ty/iaphub-go/webhook"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type inboxFactory func(t *testing.T, path string) webhook.Inbox
+
+func inboxFactories() map[string]inboxFactory {
+	return map[string]inboxFactory{
+		"file": func(t *testing.T, path string) webhook.Inbox {
+			inbox, err := webhook.NewFileInbox(path)
+			if err != nil {
+				t.Fatalf("NewFileInbox failed: %s", err)
+			}
+			return inbox
+		},
+		"log": func(t *testing.T, path string) webhook.Inbox {
+			inbox, err := webhook.NewLogInbox(path)
+			if err != nil {
+				t.Fatalf("NewLogInbox failed: %s", err)
+			}
+			t.Cleanup(func() { inbox.Close() })
+			return inbox
+		},
+	}
+}
+
+func TestInboxes(t *testing.T) {
+	for name, open := range inboxFactories() {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "inbox")
+			inbox := open(t, path)
+
+			for _, id := range []string{"event-1", "event-2", "event-1"} {
+				if err := inbox.Push(webhook.Event{Id: id, Type: webhook.EventTypeTest}); err != nil {
+					t.Fatalf("Push failed: %s", err)
+				}
+			}
+
+			first := expectClaim(t, inbox, time.Now(), "event-1")
+			second := expectClaim(t, inbox, time.Now(), "event-2")
+			expectClaim(t, inbox, time.Now(), "")
+
+			first.Attempts = 1
+			first.LastError = "failure"
+			first.NextAttempt = time.Now().Add(time.Hour)
+			if err := inbox.Retry(first); err != nil {
+				t.Errorf("Retry failed: %s", err)
+			}
+			expectClaim(t, inbox, time.Now(), "")
+
+			second.LastError = "fatal"
+			if err := inbox.DeadLetter(second); err != nil {
+				t.Errorf("DeadLetter failed: %s", err)
+			}
+
+			// State survives a restart, claims do not
+			reopened := open(t, path)
+			retried := expectClaim(t, reopened, time.Now().Add(2*time.Hour), "event-1")
+			if retried.Attempts != 1 || retried.LastError != "failure" {
+				t.Errorf("wrong retried message: %#v", retried)
+			}
+			if err := reopened.Ack("event-1"); err != nil {
+				t.Errorf("Ack failed: %s", err)
+			}
+
+			dead, _ := reopened.DeadLetters()
+			if len(dead) != 1 || dead[0].Event.Id != "event-2" || dead[0].LastError != "fatal" {
+				t.Fatalf("wrong dead letters: %#v", dead)
+			}
+			if err := reopened.Push(webhook.Event{Id: "event-2"}); err != nil {
+				t.Errorf("Push failed: %s", err)
+			}
+			expectClaim(t, reopened, time.Now().Add(2*time.Hour), "")
+
+			if err := reopened.Replay("event-2"); err != nil {
+				t.Errorf("Replay failed: %s", err)
+			}
+			replayed := expectClaim(t, reopened, time.Now(), "event-2")
+			if replayed.Attempts != 0 {
+				t.Errorf("attempts were not reset: %d", replayed.Attempts)
+			}
+			if err := reopened.Replay("event-2"); err != webhook.ErrMessageNotFound {
+				t.Errorf("wrong Replay error; expected: %s, got: %v", webhook.ErrMessageNotFound, err)
+			}
+		})
+	}
+}
+
+func TestLogInbox_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox.log")
+	inbox, _ := webhook.NewLogInbox(path)
+	for _, id := range []string{"event-1", "event-2", "event-3"} {
+		_ = inbox.Push(webhook.Event{Id: id})
+	}
+	_ = inbox.Ack("event-2")
+
+	if err := inbox.Compact(); err != nil {
+		t.Fatalf("Compact failed: %s", err)
+	}
+	_ = inbox.Push(webhook.Event{Id: "event-4"})
+	inbox.Close()
+
+	reopened, _ := webhook.NewLogInbox(path)
+	defer reopened.Close()
+	var ids []string
+	for {
+		m, ok, _ := reopened.Claim(time.Now())
+		if !ok {
+			break
+		}
+		ids = append(ids, m.Event.Id)
+	}
+	if len(ids) != 3 {
+		t.Errorf("wrong messages after compaction: %v", ids)
+	}
+}
+
+func TestLogInbox_TornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox.log")
+	inbox, _ := webhook.NewLogInbox(path)
+	_ = inbox.Push(webhook.Event{Id: "event-1"})
+	inbox.Close()
+
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	_, _ = file.WriteString(`{"op":"push","eventId":"event-2","mess`)
+	file.Close()
+
+	reopened, err := webhook.NewLogInbox(path)
+	if err != nil {
+		t.Fatalf("NewLogInbox failed after torn write: %s", err)
+	}
+	if err := reopened.Push(webhook.Event{Id: "event-3"}); err != nil {
+		t.Fatalf("Push failed: %s", err)
+	}
+	reopened.Close()
+
+	for i := 0; i < 2; i++ {
+		inbox, err := webhook.NewLogInbox(path)
+		if err != nil {
+			t.Fatalf("NewLogInbox failed on reopening %d: %s", i+1, err)
+		}
+		var ids []string
+		for {
+			m, ok, _ := inbox.Claim(time.Now())
+			if !ok {
+				break
+			}
+			ids = append(ids, m.Event.Id)
+		}
+		inbox.Close()
+		sort.Strings(ids)
+		if !reflect.DeepEqual(ids, []string{"event-1", "event-3"}) {
+			t.Errorf("wrong messages on reopening %d: %v", i+1, ids)
+		}
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	inbox, _ := webhook.NewFileInbox(t.TempDir())
+	handler, _ := webhook.NewHandler(token, webhook.Enqueue(inbox))
+
+	if code := serve(handler, http.MethodPost, token, eventBody).Code; code != http.StatusOK {
+		t.Fatalf("wrong status; expected: %d, got: %d", http.StatusOK, code)
+	}
+	_ = inbox.Push(webhook.Event{Id: "event-2", Type: webhook.EventTypeTest})
+
+	attempts := map[string]int{}
+	processor, _ := webhook.NewProcessor(inbox, func(ctx context.Context, event webhook.Event) error {
+		attempts[event.Id]++
+		if event.Id == "event-2" {
+			return errors.New("always failing")
+		}
+		return nil
+	}, webhook.UseMaxAttempts(3), webhook.UseBackoff(time.Millisecond, 2*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		if _, err := processor.ProcessDue(context.Background()); err != nil {
+			t.Fatalf("ProcessDue failed: %s", err)
+		}
+		time.Sleep(3 * time.Millisecond)
+	}
+
+	if attempts["event-1"] != 1 || attempts["event-2"] != 3 {
+		t.Errorf("wrong attempts: %v", attempts)
+	}
+	dead, _ := inbox.DeadLetters()
+	if len(dead) != 1 || dead[0].Event.Id != "event-2" || dead[0].Attempts != 3 || dead[0].LastError != "always failing" {
+		t.Errorf("wrong dead letters: %#v", dead)
+	}
+}
+
+func TestProcessor_Run(t *testing.T) {
+	inbox, _ := webhook.NewLogInbox(filepath.Join(t.TempDir(), "inbox.log"))
+	defer inbox.Close()
+
+	var mu sync.Mutex
+	processed := map[string]bool{}
+	done := make(chan struct{})
+	processor, _ := webhook.NewProcessor(inbox, func(ctx context.Context, event webhook.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		processed[event.Id] = true
+		if len(processed) == 20 {
+			close(done)
+		}
+		return nil
+	}, webhook.UseWorkers(3), webhook.UsePollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- processor.Run(ctx)
+	}()
+
+	for i := 0; i < 20; i++ {
+		_ = inbox.Push(webhook.Event{Id: "event-" + string(rune('a'+i))})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("events were not processed")
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Errorf("Run failed: %s", err)
+	}
+}
+
+func TestProcessor_RunShutdown(t *testing.T) {
+	inbox, _ := webhook.NewLogInbox(filepath.Join(t.TempDir(), "inbox.log"))
+	defer inbox.Close()
+	_ = inbox.Push(webhook.Event{Id: "event-1"})
+
+	started := make(chan struct{})
+	processor, _ := webhook.NewProcessor(inbox, func(ctx context.Context, event webhook.Event) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, webhook.UseWorkers(1), webhook.UseMaxAttempts(1), webhook.UsePollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- processor.Run(ctx)
+	}()
+	<-started
+	cancel()
+	if err := <-result; err != nil {
+		t.Errorf("Run failed: %s", err)
+	}
+
+	if dead, _ := inbox.DeadLetters(); len(dead) != 0 {
+		t.Errorf("expected no dead letter after shutdown, got: %+v", dead)
+	}
+	if m := expectClaim(t, inbox, time.Now(), "event-1"); m.Attempts != 0 {
+		t.Errorf("wrong attempts; expected: 0, got: %d", m.Attempts)
+	}
+}
+
+func expectClaim(t *testing.T, inbox webhook.Inbox, now time.Time, eventId string) webhook.Message {
+	t.Helper()
+	m, ok, err := inbox.Claim(now)
+	if err != nil {
+		t.Fatalf("Claim failed: %s", err)
+	}
+	if eventId == "" && ok {
+		t.Errorf("unexpected claim of %s", m.Event.Id)
+	} else if eventId != "" && (!ok || m.Event.Id != eventId) {
+		t.Errorf("wrong claim; expected: %s, got: %s (%t)", eventId, m.Event.Id, ok)
+	}
+
+	return m
+}
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Processor handles the events stored in an Inbox with a pool of workers.
+// Failed events are retried with exponential backoff, and moved to the dead-letter queue
+// once the maximum number of attempts is reached.
+type Processor struct {
+	inbox  Inbox
+	fn     HandlerFunc
+	config *processorConfig
+}
+
+func NewProcessor(inbox Inbox, fn HandlerFunc, options ...ProcessorOption) (*Processor, error) {
+	if inbox == nil {
+		return nil, errors.New("inbox is not specified")
+	} else if fn == nil {
+		return nil, errors.New("handler func is not specified")
+	}
+
+	config := &processorConfig{
+		workers:      4,
+		maxAttempts:  10,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Hour,
+		pollInterval: time.Second,
+	}
+	for _, o := range options {
+		err := o(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Processor{
+		inbox:  inbox,
+		fn:     fn,
+		config: config,
+	}, nil
+}
+
+// Run processes events until ctx is done, then waits for the events being processed and returns.
+// Workers poll the inbox when it has no due event. An inbox error stops all workers and is returned.
+func (p *Processor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, p.config.workers)
+
+	for w := 0; w < p.config.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(p.config.pollInterval)
+			defer ticker.Stop()
+
+			for {
+				processed, err := p.processNext(ctx)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				if processed {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// ProcessDue processes the events due now, one at a time, and returns the number of events handled.
+func (p *Processor) ProcessDue(ctx context.Context) (int, error) {
+	count := 0
+	for {
+		processed, err := p.processNext(ctx)
+		if err != nil || !processed {
+			return count, err
+		}
+		count++
+	}
+}
+
+// processNext handles the next due message, it reports false when there is none or ctx is done.
+// Errors of the handler are recorded in the message, only inbox errors are returned.
+// A failure once ctx is done, e.g. a handler interrupted by a shutdown, does not count as an attempt.
+func (p *Processor) processNext(ctx context.Context) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	m, ok, err := p.inbox.Claim(time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err = p.fn(ctx, m.Event); err == nil {
+		return true, p.inbox.Ack(m.Event.Id)
+	}
+	if ctx.Err() != nil {
+		m.NextAttempt = time.Now()
+		return true, p.inbox.Retry(m)
+	}
+
+	m.Attempts++
+	m.LastError = err.Error()
+	if m.Attempts >= p.config.maxAttempts {
+		return true, p.inbox.DeadLetter(m)
+	}
+	m.NextAttempt = time.Now().Add(p.backoff(m.Attempts))
+
+	return true, p.inbox.Retry(m)
+}
+
+func (p *Processor) backoff(attempts int) time.Duration {
+	backoff := p.config.minBackoff
+	for i := 1; i < attempts && backoff < p.config.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.config.maxBackoff {
+		backoff = p.config.maxBackoff
+	}
+
+	return backoff
+}
+
+// UseWorkers sets the number of events processed concurrently (4 by default).
+func UseWorkers(workers int) ProcessorOption {
+	return func(c *processorConfig) error {
+		if workers <= 0 {
+			return errors.New("number of workers must be positive")
+		}
+		c.workers = workers
+
+		return nil
+	}
+}
+
+// UseMaxAttempts sets after how many failed attempts an event is dead-lettered (10 by default).
+func UseMaxAttempts(maxAttempts int) ProcessorOption {
+	return func(c *processorConfig) error {
+		if maxAttempts <= 0 {
+			return errors.New("maximum number of attempts must be positive")
+		}
+		c.maxAttempts = maxAttempts
+
+		return nil
+	}
+}
+
+// UseBackoff sets the delay before the first retry, doubled for each following retry up to max
+// (one second to one hour by default).
+func UseBackoff(min time.Duration, max time.Duration) ProcessorOption {
+	return func(c *processorConfig) error {
+		if min <= 0 || max < min {
+			return errors.New("invalid backoff range")
+		}
+		c.minBackoff = min
+		c.maxBackoff = max
+
+		return nil
+	}
+}
+
+// UsePollInterval sets how often idle workers check the inbox for due events (every second by default).
+func UsePollInterval(interval time.Duration) ProcessorOption {
+	return func(c *processorConfig) error {
+		if interval <= 0 {
+			return errors.New("poll interval must be positive")
+		}
+		c.pollInterval = interval
+
+		return nil
+	}
+}
+
+type processorConfig struct {
+	workers      int
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	pollInterval time.Duration
+}
+
+type ProcessorOption func(*processorConfig) error